@@ -0,0 +1,99 @@
+package sectiontrace
+
+import (
+	"context"
+	"fmt"
+)
+
+// ArgElided and ArgCriticalPath are set by the mindur and critpath
+// packages. They are defined here so that they are reserved.
+const ArgElided = "elided"
+const ArgCriticalPath = "cp"
+
+var reservedArgs = map[string]bool{
+	ArgParent:              true,
+	ArgAncestor:            true,
+	ArgRemoteParent:        true,
+	ArgRemoteParentScope:   true,
+	ArgRemoteAncestor:      true,
+	ArgRemoteAncestorScope: true,
+	ArgOK:                  true,
+	ArgFollowsFrom:         true,
+	ArgLinks:               true,
+	ArgSpawnWait:           true,
+	ArgOutlivedParent:      true,
+	ArgElided:              true,
+	ArgCriticalPath:        true,
+}
+
+// FromContext returns the innermost section ctx was returned from, so
+// that helpers can annotate the section they are running in. If ctx is
+// not within a recorded section, the returned section ignores all
+// annotations.
+func FromContext(ctx context.Context) ActiveSection {
+	if c, ok := ctx.(*sampledOutContext); ok {
+		return (*sampledOutSection)(c)
+	}
+	if ctx != nil {
+		if s, ok := ctx.Value(sectionStateKey{}).(*sectionState); ok && s.current != nil {
+			return s.current
+		}
+	}
+	return noSection{}
+}
+
+func (a *activeSection) SetArg(key string, value interface{}) {
+	if reservedArgs[key] {
+		doUsageError(fmt.Errorf("Arg %q is reserved (section %q)", key, a.kind.name))
+		return
+	}
+
+	a.setExtraArg(key, value)
+}
+
+func (a *activeSection) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.wasClosed {
+		a.failed = true
+	}
+}
+
+func (a *activeSection) Mark(name string) {
+	if OnMark == nil {
+		return
+	}
+
+	a.mu.Lock()
+	closed := a.wasClosed
+	a.mu.Unlock()
+	if closed {
+		return
+	}
+
+	begin := a.GetBeginRecord()
+	OnMark(begin, makeRecord(name, a.nodeID, Instant, getTimeNow()))
+}
+
+func (s *sampledOutSection) SetArg(key string, value interface{}) {}
+func (s *sampledOutSection) SetError(err error)                   {}
+func (s *sampledOutSection) Mark(name string)                     {}
+
+// noSection is returned by FromContext outside of any section.
+type noSection struct{}
+
+func (noSection) End(err error) {}
+
+func (noSection) NextPhase(next Section) (context.Context, ActiveSection) {
+	return next.Begin(context.Background())
+}
+
+func (noSection) GetBeginRecord() *Record              { return nil }
+func (noSection) SetArg(key string, value interface{}) {}
+func (noSection) SetError(err error)                   {}
+func (noSection) Mark(name string)                     {}
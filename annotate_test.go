@@ -0,0 +1,106 @@
+package sectiontrace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func helper(ctx context.Context, i int) {
+	sec := FromContext(ctx)
+	sec.SetArg(fmt.Sprintf("k%d", i), i)
+	if i == 3 {
+		sec.SetError(fmt.Errorf("helper %d failed", i))
+	}
+	sec.Mark("helper")
+}
+
+func TestFromContext(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 0
+
+	var marks []*Record
+	var marksMu sync.Mutex
+	OnMark = func(section, mark *Record) {
+		marksMu.Lock()
+		defer marksMu.Unlock()
+		if section.ID != mark.ID {
+			t.Errorf("mark %d in section %d", mark.ID, section.ID)
+		}
+		marks = append(marks, mark)
+	}
+	defer func() { OnMark = nil }()
+
+	err := New("annotated").Do(context.Background(), func(ctx context.Context) error {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				helper(ctx, i)
+			}(i)
+		}
+		wg.Wait()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := collectedRecords[len(collectedRecords)-1]
+	if end.Phase != End || end.AllArgs()[ArgOK] != false {
+		t.Errorf("end record = %+v", end)
+	}
+	for i := 0; i < 5; i++ {
+		if end.AllArgs()[fmt.Sprintf("k%d", i)] != i {
+			t.Errorf("arg k%d missing: %v", i, end.AllArgs())
+		}
+	}
+	if len(marks) != 5 || marks[0].Phase != Instant || marks[0].Name != "helper" {
+		t.Errorf("marks = %+v", marks)
+	}
+
+	// Outside of any section, annotations are ignored.
+	helper(context.Background(), 0)
+	sec := FromContext(context.Background())
+	if sec.GetBeginRecord() != nil {
+		t.Errorf("got a begin record outside of any section")
+	}
+}
+
+func TestSetReservedArg(t *testing.T) {
+	saved := usageErrors
+	defer func() { usageErrors = saved }()
+	usageErrors = nil
+
+	_ = New("reserved").Do(context.Background(), func(ctx context.Context) error {
+		for _, key := range []string{ArgOK, ArgElided, ArgCriticalPath} {
+			FromContext(ctx).SetArg(key, true)
+		}
+		return nil
+	})
+	if len(usageErrors) != 3 {
+		t.Errorf("usage errors = %v", usageErrors)
+	}
+}
+
+func TestAnnotateConcurrentWithEnd(t *testing.T) {
+	collectedRecords = nil
+
+	for i := 0; i < 100; i++ {
+		_, sec := New("racy").Begin(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for j := 0; j < 10; j++ {
+				sec.SetArg(fmt.Sprintf("k%d", j), j)
+				sec.SetError(fmt.Errorf("late"))
+			}
+		}()
+		sec.End(nil)
+		<-done
+	}
+}
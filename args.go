@@ -13,33 +13,240 @@ const ArgRemoteAncestor = "ra"
 const ArgRemoteAncestorScope = "ras"
 const ArgOK = "ok"
 
-func setArgsFromContext(ctx context.Context, args map[string]interface{}) error {
+// ArgFollowsFrom is set on sections begun from a context returned by
+// Detach, to the ID of the section that started them.
+const ArgFollowsFrom = "f"
+
+type sectionStateKey struct{}
+
+// sectionState is what a context passes on to sections begun from it.
+// It is stored under sectionStateKey by the contexts created by this
+// package, and is never modified once stored.
+type sectionState struct {
+	parent, ancestor       int32
+	hasParent, hasAncestor bool
+	followsFrom            int32
+	hasFollowsFrom         bool
+	links                  []Link
+	sampledOut             bool
+	err                    error
+
+	// remote has no Parent within detached sections, which only keep
+	// the remote ancestor.
+	remote *RemoteInfo
+
+	// current is the section this state was inherited from, if any.
+	current *activeSection
+}
+
+// isRoot reports whether a section begun with this state starts a trace.
+// Detached sections continue the trace they follow from.
+func (s *sectionState) isRoot() bool {
+	return !s.hasParent && s.remote == nil && !s.hasFollowsFrom
+}
+
+// stateFromContext looks up the section state with a single Value call.
+// The exported context keys are only consulted for contexts that do not
+// come from this package, for compatibility with code setting them
+// directly.
+func stateFromContext(ctx context.Context) (sectionState, error) {
+	if ctx == nil {
+		return sectionState{}, nil
+	}
+	if s, ok := ctx.Value(sectionStateKey{}).(*sectionState); ok {
+		return *s, s.err
+	}
+
+	var state sectionState
+
 	if v := ctx.Value(ParentNodeContextKey); v != nil {
 		unpacked, ok := v.(int32)
 		if !ok {
-			return fmt.Errorf("Invalid value for ParentNodeContextKey: %v", v)
+			return state, fmt.Errorf("Invalid value for ParentNodeContextKey: %v", v)
 		}
-		args[ArgParent] = unpacked
+		state.parent, state.hasParent = unpacked, true
 	}
 
 	if v := ctx.Value(AncestorNodeContextKey); v != nil {
 		unpacked, ok := v.(int32)
 		if !ok {
-			return fmt.Errorf("Invalid value for AncestorNodeContextKey: %v", v)
+			return state, fmt.Errorf("Invalid value for AncestorNodeContextKey: %v", v)
 		}
-		args[ArgAncestor] = unpacked
+		state.ancestor, state.hasAncestor = unpacked, true
 	}
 
-	info, err := RemoteInfoFromContext(ctx)
+	info, err := remoteInfoFromKeys(ctx)
 	if err != nil {
-		return err
+		return state, err
 	}
-	if info != nil {
-		args[ArgRemoteParent] = info.Parent.ID
-		args[ArgRemoteAncestor] = info.Ancestor.ID
-		args[ArgRemoteParentScope] = info.Parent.Scope
-		args[ArgRemoteAncestorScope] = info.Ancestor.Scope
+	state.remote = info
+
+	return state, nil
+}
+
+// legacyValue answers lookups of the exported context keys from a state.
+// The state is authoritative for those keys, so it reports whether key
+// is one of them even if the value is unset.
+func (s *sectionState) legacyValue(key interface{}) (interface{}, bool) {
+	switch key {
+	case ParentNodeContextKey:
+		if s.hasParent {
+			return s.parent, true
+		}
+	case AncestorNodeContextKey:
+		if s.hasAncestor {
+			return s.ancestor, true
+		}
+	case RemoteParentNodeContextKey:
+		if s.hasRemoteParent() {
+			return s.remote.Parent.ID, true
+		}
+	case RemoteParentScopeContextKey:
+		if s.hasRemoteParent() {
+			return s.remote.Parent.Scope, true
+		}
+	case RemoteAncestorNodeContextKey:
+		if s.remote != nil {
+			return s.remote.Ancestor.ID, true
+		}
+	case RemoteAncestorScopeContextKey:
+		if s.remote != nil {
+			return s.remote.Ancestor.Scope, true
+		}
+	default:
+		return nil, false
 	}
+	return nil, true
+}
+
+// stateArgs are the args a section's state is recorded in, in the order
+// they are set.
+var stateArgs = []string{
+	ArgParent,
+	ArgAncestor,
+	ArgFollowsFrom,
+	ArgLinks,
+	ArgRemoteParent,
+	ArgRemoteParentScope,
+	ArgRemoteAncestor,
+	ArgRemoteAncestorScope,
+}
 
-	return nil
+// arg returns the value a section begun with this state records for one
+// of the stateArgs.
+func (s *sectionState) arg(key string) (interface{}, bool) {
+	switch key {
+	case ArgParent:
+		if s.hasParent {
+			return s.parent, true
+		}
+	case ArgAncestor:
+		if s.hasAncestor {
+			return s.ancestor, true
+		}
+	case ArgFollowsFrom:
+		if s.hasFollowsFrom {
+			return s.followsFrom, true
+		}
+	case ArgLinks:
+		if len(s.links) > 0 {
+			return s.links, true
+		}
+	case ArgRemoteParent:
+		if s.hasRemoteParent() {
+			return s.remote.Parent.ID, true
+		}
+	case ArgRemoteParentScope:
+		if s.hasRemoteParent() {
+			return s.remote.Parent.Scope, true
+		}
+	case ArgRemoteAncestor:
+		if s.remote != nil {
+			return s.remote.Ancestor.ID, true
+		}
+	case ArgRemoteAncestorScope:
+		if s.remote != nil {
+			return s.remote.Ancestor.Scope, true
+		}
+	}
+	return nil, false
+}
+
+func (s *sectionState) setArgs(args map[string]interface{}) {
+	for _, key := range stateArgs {
+		if v, ok := s.arg(key); ok {
+			args[key] = v
+		}
+	}
+}
+
+// typedArgs are the args of the records made by this package, kept as
+// they are until AllArgs or JSON encoding asks for a map, so that
+// recording a section does not allocate one.
+type typedArgs struct {
+	state *sectionState
+	extra map[string]interface{}
+	ok    bool
+	hasOK bool
+}
+
+func (t *typedArgs) arg(key string) (interface{}, bool) {
+	if t.hasOK && key == ArgOK {
+		return t.ok, true
+	}
+	if v, ok := t.extra[key]; ok {
+		return v, true
+	}
+	if t.state != nil {
+		return t.state.arg(key)
+	}
+	return nil, false
+}
+
+func (t *typedArgs) setArgs(args map[string]interface{}) {
+	if t.state != nil {
+		t.state.setArgs(args)
+	}
+	for k, v := range t.extra {
+		args[k] = v
+	}
+	if t.hasOK {
+		args[ArgOK] = t.ok
+	}
+}
+
+func (t *typedArgs) empty() bool {
+	if t.hasOK || len(t.extra) > 0 {
+		return false
+	}
+	if t.state == nil {
+		return true
+	}
+	for _, key := range stateArgs {
+		if _, ok := t.state.arg(key); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *sectionState) hasRemoteParent() bool {
+	return s.remote != nil && s.remote.Parent.ID != 0
+}
+
+// stateContext attaches a section state to a context outside of any
+// section, e.g. remote info received from another process.
+type stateContext struct {
+	context.Context
+	state sectionState
+}
+
+func (c *stateContext) Value(key interface{}) interface{} {
+	if key == (sectionStateKey{}) {
+		return &c.state
+	}
+	if v, ok := c.state.legacyValue(key); ok {
+		return v
+	}
+	return c.Context.Value(key)
 }
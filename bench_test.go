@@ -0,0 +1,134 @@
+package sectiontrace
+
+import (
+	"context"
+	"testing"
+)
+
+// withHooks runs fn with the given hooks installed in place of the ones
+// set up by the tests.
+func withHooks(onBegin func(*Record), onEnd func(*Record, *Record), fn func()) {
+	savedBegin, savedEnd := OnBegin, OnEnd
+	OnBegin, OnEnd = onBegin, onEnd
+	defer func() { OnBegin, OnEnd = savedBegin, savedEnd }()
+	fn()
+}
+
+func withSampler(sampler Sampler, fn func()) {
+	DefaultSampler = sampler
+	defer func() { DefaultSampler = nil }()
+	fn()
+}
+
+var benchSection = New("bench")
+var benchChild = New("bench.child")
+
+func noopCallback(context.Context) error { return nil }
+
+func benchBeginEnd(b *testing.B) {
+	ctx, root := benchSection.Begin(context.Background())
+	defer root.End(nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, sec := benchChild.Begin(ctx)
+		sec.End(nil)
+	}
+}
+
+func benchDo(b *testing.B) {
+	ctx, root := benchSection.Begin(context.Background())
+	defer root.End(nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = benchChild.Do(ctx, noopCallback)
+	}
+}
+
+func BenchmarkBeginEndNoSink(b *testing.B) {
+	withHooks(nil, nil, func() { benchBeginEnd(b) })
+}
+
+func BenchmarkBeginEndSampledOut(b *testing.B) {
+	withSampler(NeverSample, func() { benchBeginEnd(b) })
+}
+
+func BenchmarkBeginEndNoopSink(b *testing.B) {
+	withHooks(func(*Record) {}, func(*Record, *Record) {}, func() { benchBeginEnd(b) })
+}
+
+func BenchmarkDoNoSink(b *testing.B) {
+	withHooks(nil, nil, func() { benchDo(b) })
+}
+
+func BenchmarkDoSampledOut(b *testing.B) {
+	withSampler(NeverSample, func() { benchDo(b) })
+}
+
+func BenchmarkDoNoopSink(b *testing.B) {
+	withHooks(func(*Record) {}, func(*Record, *Record) {}, func() { benchDo(b) })
+}
+
+// TestAllocs checks that recording a section does not allocate, whether
+// its records go to a sink, nowhere, or it was not sampled. Sections are
+// allocated in blocks, so this holds on average over a block.
+func TestAllocs(t *testing.T) {
+	check := func(name string) {
+		ctx, root := benchSection.Begin(context.Background())
+		defer root.End(nil)
+
+		if n := testing.AllocsPerRun(1000, func() {
+			_, sec := benchChild.Begin(ctx)
+			sec.End(nil)
+		}); n != 0 {
+			t.Errorf("%s: Begin/End allocates %v times", name, n)
+		}
+		if n := testing.AllocsPerRun(1000, func() {
+			_ = benchChild.Do(ctx, noopCallback)
+		}); n != 0 {
+			t.Errorf("%s: Do allocates %v times", name, n)
+		}
+	}
+
+	withHooks(func(*Record) {}, func(*Record, *Record) {}, func() { check("no-op sink") })
+	withHooks(nil, nil, func() { check("no sink") })
+	withSampler(NeverSample, func() { check("sampled out") })
+}
+
+// TestRecordsOutliveSections checks that records kept by a sink are not
+// overwritten by later sections.
+func TestRecordsOutliveSections(t *testing.T) {
+	var begins, ends []*Record
+	withHooks(func(begin *Record) {
+		begins = append(begins, begin)
+	}, func(_, end *Record) {
+		ends = append(ends, end)
+	}, func() {
+		ctx, root := benchSection.Begin(context.Background())
+		for i := 0; i < 3*sectionBlockSize; i++ {
+			_, sec := benchChild.Begin(ctx)
+			if i%2 == 0 {
+				sec.SetArg("even", i)
+			}
+			sec.End(nil)
+		}
+		root.End(nil)
+	})
+
+	rootID := begins[0].ID
+	for i, end := range ends[:len(ends)-1] {
+		if end.ID != begins[i+1].ID || end.Phase != End {
+			t.Fatalf("end %d = %+v, begin %+v", i, end, begins[i+1])
+		}
+		args := end.AllArgs()
+		if args[ArgParent] != rootID || args[ArgOK] != true {
+			t.Errorf("end %d args = %v", i, args)
+		}
+		if v, ok := end.Arg("even"); ok != (i%2 == 0) || (ok && v != i) {
+			t.Errorf("end %d args = %v", i, args)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func testRecords(n int) []*sectiontrace.Record {
+	var recs []*sectiontrace.Record
+	for i := 0; i < n; i++ {
+		recs = append(recs, &sectiontrace.Record{
+			Category:        "Section",
+			Name:            "section",
+			Phase:           sectiontrace.Begin,
+			Scope:           "scope",
+			TimestampMicros: 1600000000000000 + int64(i)*37,
+			ID:              int32(i + 1),
+			ProcessID:       123,
+			Args: map[string]interface{}{
+				"p":     int32(i),
+				"rps":   "remote",
+				"ok":    i%3 == 0,
+				"f":     1.5,
+				"n":     int64(-i),
+				"other": []interface{}{"x", 1.0},
+			},
+		})
+	}
+	return recs
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := testRecords(1000)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.BlockSize = 1024
+	for _, rec := range want {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonSize, _ := json.Marshal(want)
+	if buf.Len()*3 > len(jsonSize) {
+		t.Errorf("binary encoding is %d bytes, JSON is %d", buf.Len(), len(jsonSize))
+	}
+
+	got, err := ReadAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch: got %d records, want %d", len(got), len(want))
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	recs := testRecords(100)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.BlockSize = 256
+	for _, rec := range recs[:50] {
+		w.Write(rec)
+	}
+	w.Flush()
+	firstHalf := buf.Len()
+
+	// Appending with a new writer repeats the file header.
+	w = NewWriter(&buf)
+	w.BlockSize = 256
+	for _, rec := range recs[50:] {
+		w.Write(rec)
+	}
+	w.Flush()
+
+	data := append([]byte(nil), buf.Bytes()...)
+	// Damage a block in the first half, and truncate the last block.
+	data[firstHalf/2] ^= 0xff
+	data = data[:len(data)-10]
+
+	r := NewReader(bytes.NewReader(data))
+	var got []*sectiontrace.Record
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, rec)
+	}
+
+	if len(got) < 80 || len(got) >= 100 {
+		t.Errorf("recovered %d records", len(got))
+	}
+	if r.Skipped() == 0 {
+		t.Errorf("no bytes reported as skipped")
+	}
+	seen := map[int32]bool{}
+	for _, rec := range got {
+		if seen[rec.ID] {
+			t.Errorf("record %d duplicated", rec.ID)
+		}
+		seen[rec.ID] = true
+	}
+}
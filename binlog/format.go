@@ -0,0 +1,44 @@
+// Package binlog is a compact, append-only binary encoding of records.
+//
+// A file starts with FileMagic, followed by blocks. Each block is
+//
+//	blockMagic      4 bytes
+//	length          4 bytes, little endian
+//	crc32           4 bytes, little endian (Castagnoli) of the payload
+//	payload         length bytes
+//
+// The payload is a uvarint record count followed by the records. Strings
+// (names, categories, scopes, phases, arg keys and string arg values)
+// are interned per block, and timestamps are delta-encoded from the
+// previous record in the block, so every block can be decoded on its
+// own. A reader that finds a damaged block skips ahead to the next
+// block marker, so a crash mid-write loses at most the last block.
+//
+// Appending to an existing file with a new Writer is allowed; the
+// repeated FileMagic is skipped when reading.
+package binlog
+
+import "hash/crc32"
+
+const FileMagic = "STRACE\x00\x01"
+
+const blockMagic = "\xffSTB"
+
+const blockHeaderSize = 12
+
+// MaxBlockSize bounds the payload size accepted by the reader.
+const MaxBlockSize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Arg value tags.
+const (
+	tagNil byte = iota
+	tagFalse
+	tagTrue
+	tagInt32
+	tagInt64
+	tagFloat64
+	tagString
+	tagJSON
+)
@@ -0,0 +1,291 @@
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+var errCorrupt = errors.New("Corrupt block")
+
+// Reader decodes records written by Writer.
+type Reader struct {
+	src     io.Reader
+	srcErr  error
+	buf     []byte
+	pending []*sectiontrace.Record
+	skipped int64
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{src: r}
+}
+
+// Skipped returns the number of bytes skipped so far because they were
+// not part of an intact block.
+func (r *Reader) Skipped() int64 {
+	return r.skipped
+}
+
+// fill tries to make at least n bytes available in buf.
+func (r *Reader) fill(n int) bool {
+	for len(r.buf) < n && r.srcErr == nil {
+		chunk := make([]byte, 32<<10)
+		k, err := r.src.Read(chunk)
+		r.buf = append(r.buf, chunk[:k]...)
+		if err != nil {
+			r.srcErr = err
+		}
+	}
+	return len(r.buf) >= n
+}
+
+func (r *Reader) skip(n int) {
+	r.skipped += int64(n)
+	r.buf = r.buf[n:]
+}
+
+// Next returns the next record, or io.EOF at the end of the input.
+func (r *Reader) Next() (*sectiontrace.Record, error) {
+	for len(r.pending) == 0 {
+		if err := r.nextBlock(); err != nil {
+			return nil, err
+		}
+	}
+	rec := r.pending[0]
+	r.pending = r.pending[1:]
+	return rec, nil
+}
+
+func (r *Reader) nextBlock() error {
+	for {
+		if !r.fill(len(blockMagic)) {
+			r.skip(len(r.buf))
+			return r.endError()
+		}
+		if r.fill(len(FileMagic)) && string(r.buf[:len(FileMagic)]) == FileMagic {
+			r.buf = r.buf[len(FileMagic):]
+			continue
+		}
+		if string(r.buf[:len(blockMagic)]) != blockMagic {
+			r.skip(1)
+			continue
+		}
+		if !r.fill(blockHeaderSize) {
+			r.skip(len(r.buf))
+			return r.endError()
+		}
+		length := binary.LittleEndian.Uint32(r.buf[4:8])
+		checksum := binary.LittleEndian.Uint32(r.buf[8:12])
+		if length > MaxBlockSize {
+			r.skip(1)
+			continue
+		}
+		if !r.fill(blockHeaderSize + int(length)) {
+			// Either the last block was truncated, or the length is
+			// corrupt; look for a later block in what we have.
+			r.skip(1)
+			continue
+		}
+		payload := r.buf[blockHeaderSize : blockHeaderSize+int(length)]
+		if crc32.Checksum(payload, crcTable) != checksum {
+			r.skip(1)
+			continue
+		}
+		recs, err := decodeBlock(payload)
+		if err != nil {
+			r.skip(1)
+			continue
+		}
+		r.buf = r.buf[blockHeaderSize+int(length):]
+		r.pending = recs
+		return nil
+	}
+}
+
+func (r *Reader) endError() error {
+	if r.srcErr == nil || r.srcErr == io.EOF {
+		return io.EOF
+	}
+	return r.srcErr
+}
+
+type decoder struct {
+	data    []byte
+	strings []string
+	err     error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) take(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.data)) {
+		d.err = errCorrupt
+		return nil
+	}
+	rv := d.data[:n]
+	d.data = d.data[n:]
+	return rv
+}
+
+func (d *decoder) readByte() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) str() string {
+	idx := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if idx == 0 {
+		s := string(d.take(d.uvarint()))
+		d.strings = append(d.strings, s)
+		return s
+	}
+	if idx > uint64(len(d.strings)) {
+		d.err = errCorrupt
+		return ""
+	}
+	return d.strings[idx-1]
+}
+
+func (d *decoder) value() interface{} {
+	switch d.readByte() {
+	case tagNil:
+		return nil
+	case tagFalse:
+		return false
+	case tagTrue:
+		return true
+	case tagInt32:
+		return int32(d.varint())
+	case tagInt64:
+		return d.varint()
+	case tagFloat64:
+		b := d.take(8)
+		if b == nil {
+			return nil
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case tagString:
+		return d.str()
+	case tagJSON:
+		var v interface{}
+		if err := json.Unmarshal(d.take(d.uvarint()), &v); err != nil && d.err == nil {
+			d.err = errCorrupt
+		}
+		return v
+	}
+	d.err = errCorrupt
+	return nil
+}
+
+func decodeBlock(payload []byte) ([]*sectiontrace.Record, error) {
+	d := &decoder{data: payload}
+	count := d.uvarint()
+	if count > uint64(len(payload)) {
+		return nil, errCorrupt
+	}
+
+	var ts int64
+	recs := make([]*sectiontrace.Record, 0, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		rec := &sectiontrace.Record{
+			Name:     d.str(),
+			Category: d.str(),
+			Scope:    d.str(),
+			Phase:    sectiontrace.Phase(d.str()),
+		}
+		ts += d.varint()
+		rec.TimestampMicros = ts
+		rec.ID = int32(uint32(d.uvarint()))
+		rec.ProcessID = int32(uint32(d.uvarint()))
+
+		nargs := d.uvarint()
+		if nargs > uint64(len(d.data)) {
+			return nil, errCorrupt
+		}
+		rec.Args = make(map[string]interface{}, nargs)
+		for j := uint64(0); j < nargs && d.err == nil; j++ {
+			k := d.str()
+			rec.Args[k] = d.value()
+		}
+		recs = append(recs, rec)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.data) != 0 {
+		return nil, errCorrupt
+	}
+	return recs, nil
+}
+
+// ReadAll decodes all intact records from r.
+func ReadAll(r io.Reader) ([]*sectiontrace.Record, error) {
+	reader := NewReader(r)
+	var recs []*sectiontrace.Record
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+}
+
+// ReadSummary decodes all intact records from r into a Summary, ready
+// to be written out as trace_event JSON.
+func ReadSummary(r io.Reader) (*sectiontrace.Summary, error) {
+	recs, err := ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return sectiontrace.Export(recs), nil
+}
+
+// IsBinlog reports whether data (e.g. the first bytes of a file) looks
+// like the start of a binlog file.
+func IsBinlog(prefix []byte) bool {
+	return bytes.HasPrefix(prefix, []byte(FileMagic))
+}
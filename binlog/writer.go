@@ -0,0 +1,194 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+var DefaultBlockSize = 64 << 10
+
+// Writer encodes records into blocks. It is a sectiontrace.Sink, and is
+// safe for concurrent use.
+//
+// Records are buffered until the current block reaches BlockSize, so
+// call Flush periodically (and before exiting) to bound how much can be
+// lost in a crash.
+type Writer struct {
+	BlockSize int
+
+	mu          sync.Mutex
+	w           io.Writer
+	wroteHeader bool
+	payload     []byte
+	count       int
+	strings     map[string]uint64
+	prevTS      int64
+	err         error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	rv := &Writer{
+		BlockSize: DefaultBlockSize,
+		w:         w,
+	}
+	rv.resetBlock()
+	return rv
+}
+
+func (w *Writer) resetBlock() {
+	w.payload = w.payload[:0]
+	w.count = 0
+	w.strings = map[string]uint64{}
+	w.prevTS = 0
+}
+
+func (w *Writer) OnBegin(begin *sectiontrace.Record) {
+	w.Write(begin)
+}
+
+func (w *Writer) OnEnd(begin, end *sectiontrace.Record) {
+	w.Write(end)
+}
+
+func (w *Writer) OnMark(section, mark *sectiontrace.Record) {
+	w.Write(mark)
+}
+
+// Err returns the first error encountered while writing, if any. Once a
+// write has failed, further records are discarded.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *Writer) Write(rec *sectiontrace.Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	w.appendRecord(rec)
+	w.count++
+
+	if len(w.payload) >= w.BlockSize {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushLocked()
+}
+
+func (w *Writer) flushLocked() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.count == 0 {
+		return nil
+	}
+
+	var out []byte
+	if !w.wroteHeader {
+		out = append(out, FileMagic...)
+	}
+
+	body := binary.AppendUvarint(nil, uint64(w.count))
+	body = append(body, w.payload...)
+
+	out = append(out, blockMagic...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)))
+	out = binary.LittleEndian.AppendUint32(out, crc32.Checksum(body, crcTable))
+	out = append(out, body...)
+
+	if _, err := w.w.Write(out); err != nil {
+		w.err = err
+		return err
+	}
+	w.wroteHeader = true
+	w.resetBlock()
+	return nil
+}
+
+func (w *Writer) appendString(s string) {
+	if idx, ok := w.strings[s]; ok {
+		w.payload = binary.AppendUvarint(w.payload, idx)
+		return
+	}
+	w.strings[s] = uint64(len(w.strings) + 1)
+	w.payload = binary.AppendUvarint(w.payload, 0)
+	w.payload = binary.AppendUvarint(w.payload, uint64(len(s)))
+	w.payload = append(w.payload, s...)
+}
+
+func (w *Writer) appendRecord(rec *sectiontrace.Record) {
+	w.appendString(rec.Name)
+	w.appendString(rec.Category)
+	w.appendString(rec.Scope)
+	w.appendString(string(rec.Phase))
+	w.payload = binary.AppendVarint(w.payload, rec.TimestampMicros-w.prevTS)
+	w.prevTS = rec.TimestampMicros
+	w.payload = binary.AppendUvarint(w.payload, uint64(uint32(rec.ID)))
+	w.payload = binary.AppendUvarint(w.payload, uint64(uint32(rec.ProcessID)))
+
+	args := rec.AllArgs()
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.payload = binary.AppendUvarint(w.payload, uint64(len(keys)))
+	for _, k := range keys {
+		w.appendString(k)
+		w.appendValue(args[k])
+	}
+}
+
+func (w *Writer) appendValue(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.payload = append(w.payload, tagNil)
+	case bool:
+		if v {
+			w.payload = append(w.payload, tagTrue)
+		} else {
+			w.payload = append(w.payload, tagFalse)
+		}
+	case int32:
+		w.payload = append(w.payload, tagInt32)
+		w.payload = binary.AppendVarint(w.payload, int64(v))
+	case int:
+		w.payload = append(w.payload, tagInt64)
+		w.payload = binary.AppendVarint(w.payload, int64(v))
+	case int64:
+		w.payload = append(w.payload, tagInt64)
+		w.payload = binary.AppendVarint(w.payload, v)
+	case float64:
+		w.payload = append(w.payload, tagFloat64)
+		w.payload = binary.LittleEndian.AppendUint64(w.payload, math.Float64bits(v))
+	case string:
+		w.payload = append(w.payload, tagString)
+		w.appendString(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			data = []byte("null")
+		}
+		w.payload = append(w.payload, tagJSON)
+		w.payload = binary.AppendUvarint(w.payload, uint64(len(data)))
+		w.payload = append(w.payload, data...)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("to", "json", fmt.Sprintf("output format (%s)", strings.Join(formats, ", ")))
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, func(w io.Writer) error {
+		return writeFormat(w, *format, recs)
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace/critpath"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func runCritpath(args []string) error {
+	fs := flag.NewFlagSet("critpath", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default stdout)")
+	annotated := fs.String("annotate", "", "also write the trace, with the critical path annotated and added as a lane, to this file")
+	format := fs.String("to", "json", fmt.Sprintf("output format for -annotate (%s)", strings.Join(formats, ", ")))
+	fs.Parse(args)
+
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	paths := critpath.ComputeTree(tree.Build(recs))
+
+	err = writeOutput(*output, func(w io.Writer) error {
+		for _, p := range paths {
+			fmt.Fprintf(w, "%s #%d  %v\n", p.Root.Name, p.Root.ID, round(p.Duration()))
+			contributions := p.Contributions()
+			for _, n := range p.Chain() {
+				share := 100.0
+				if p.Duration() > 0 {
+					share = float64(contributions[n]) / float64(p.Duration()) * 100
+				}
+				if _, err := fmt.Fprintf(w, "  %s%s #%d  %v (%.1f%%)\n",
+					strings.Repeat("  ", n.Depth-p.Root.Depth), n.Name, n.ID, round(contributions[n]), share); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil || *annotated == "" {
+		return err
+	}
+
+	critpath.Annotate(paths...)
+	recs = append(recs, critpath.Records(paths...)...)
+	return writeOutput(*annotated, func(w io.Writer) error {
+		return writeFormat(w, *format, recs)
+	})
+}
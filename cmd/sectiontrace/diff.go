@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/steinarvk/sectiontrace/diff"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	folded := fs.Bool("folded", false, "write a differential flame graph (folded stacks) instead")
+	minZ := fs.Float64("z", 0, "only report changes significant at this z-score")
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Expected exactly two files (before and after), got %d", fs.NArg())
+	}
+	before, err := readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := readFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	beforeTree, afterTree := tree.Build(before), tree.Build(after)
+
+	return writeOutput(*output, func(w io.Writer) error {
+		if *folded {
+			return diff.WriteFolded(w, beforeTree, afterTree)
+		}
+		var changes []*diff.Change
+		for _, c := range diff.CompareTrees(beforeTree, afterTree) {
+			if c.Significant(*minZ) {
+				changes = append(changes, c)
+			}
+		}
+		if *asJSON {
+			return diff.WriteJSON(w, changes)
+		}
+		return diff.WriteText(w, changes)
+	})
+}
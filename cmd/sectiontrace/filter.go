@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func runFilter(args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	name := fs.String("name", "", "keep sections whose name matches this regexp")
+	minDuration := fs.Duration("min", 0, "keep sections at least this long")
+	maxDuration := fs.Duration("max", 0, "keep sections at most this long (0 for no limit)")
+	onlyErrors := fs.Bool("errors", false, "keep only sections that failed")
+	after := fs.Duration("after", 0, "keep sections running after this offset from the start of the trace")
+	before := fs.Duration("before", 0, "keep sections running before this offset from the start of the trace (0 for no limit)")
+	ancestors := fs.Bool("ancestors", true, "also keep the ancestors of kept sections")
+	format := fs.String("to", "json", fmt.Sprintf("output format (%s)", strings.Join(formats, ", ")))
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	var nameRE *regexp.Regexp
+	if *name != "" {
+		var err error
+		if nameRE, err = regexp.Compile(*name); err != nil {
+			return err
+		}
+	}
+
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	t := tree.Build(recs)
+
+	var start int64
+	for i, rec := range recs {
+		if i == 0 || rec.TimestampMicros < start {
+			start = rec.TimestampMicros
+		}
+	}
+	windowStart := start + after.Microseconds()
+	windowEnd := start + before.Microseconds()
+
+	keep := map[*tree.Node]bool{}
+	t.Walk(func(n *tree.Node) bool {
+		switch {
+		case nameRE != nil && !nameRE.MatchString(n.Name):
+		case n.Duration() < *minDuration:
+		case *maxDuration > 0 && n.Duration() > *maxDuration:
+		case *onlyErrors && n.OK():
+		case n.Finish() < windowStart:
+		case *before > 0 && n.Start() > windowEnd:
+		default:
+			keep[n] = true
+			if *ancestors {
+				for p := n.Parent; p != nil && !keep[p]; p = p.Parent {
+					keep[p] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var kept []*sectiontrace.Record
+	for _, rec := range recs {
+		if n := t.Lookup(rec.Scope, rec.ID); n != nil && keep[n] {
+			kept = append(kept, rec)
+		}
+	}
+
+	return writeOutput(*output, func(w io.Writer) error {
+		return writeFormat(w, *format, kept)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/binlog"
+	"github.com/steinarvk/sectiontrace/flamegraph"
+	"github.com/steinarvk/sectiontrace/jaeger"
+	"github.com/steinarvk/sectiontrace/merge"
+	"github.com/steinarvk/sectiontrace/otlp"
+	"github.com/steinarvk/sectiontrace/perfetto"
+	"github.com/steinarvk/sectiontrace/pprof"
+	"github.com/steinarvk/sectiontrace/tree"
+	"github.com/steinarvk/sectiontrace/zipkin"
+)
+
+// readFile reads a trace in either trace_event JSON (a Summary or a
+// bare array of records) or binlog format.
+func readFile(path string) ([]*sectiontrace.Record, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	prefix, _ := br.Peek(len(binlog.FileMagic))
+	if binlog.IsBinlog(prefix) {
+		recs, err := binlog.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return recs, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var recs []*sectiontrace.Record
+		if err := json.Unmarshal(data, &recs); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return recs, nil
+	}
+	var summary sectiontrace.Summary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return summary.TraceEvents, nil
+}
+
+// readFiles reads the given traces. Several files are combined with
+// merge.Merge, as they usually come from different processes, whose
+// section IDs and scopes would otherwise clash. Records repeating a
+// section already read are reported on stderr, since the commands
+// ignore them.
+func readFiles(paths []string) ([]*sectiontrace.Record, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var inputs []*sectiontrace.Summary
+	for _, path := range paths {
+		recs, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, &sectiontrace.Summary{TraceEvents: recs})
+	}
+	all := inputs[0].TraceEvents
+	if len(inputs) > 1 {
+		merged, _ := merge.Merge(inputs)
+		all = merged.TraceEvents
+	}
+	if dups := tree.Build(all).Duplicates; len(dups) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: ignoring %d records repeating sections already read, starting with %s #%d in scope %q\n",
+			len(dups), dups[0].Name, dups[0].ID, dups[0].Scope)
+	}
+	return all, nil
+}
+
+var formats = []string{"json", "bin", "folded", "speedscope", "pprof", "perfetto", "otlp", "zipkin", "jaeger"}
+
+func writeFormat(w io.Writer, format string, recs []*sectiontrace.Record) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sectiontrace.Export(recs))
+	case "bin":
+		bw := binlog.NewWriter(w)
+		for _, rec := range recs {
+			if err := bw.Write(rec); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	case "folded":
+		return flamegraph.WriteFolded(w, recs)
+	case "speedscope":
+		return flamegraph.WriteSpeedscope(w, recs, "sectiontrace")
+	case "pprof":
+		return pprof.Write(w, recs)
+	case "perfetto":
+		return perfetto.Write(w, recs)
+	case "otlp":
+		return otlp.WriteJSON(w, recs, sectiontrace.ProcessName)
+	case "zipkin":
+		return zipkin.WriteJSON(w, recs, sectiontrace.ProcessName)
+	case "jaeger":
+		return jaeger.WriteJSON(w, recs, sectiontrace.ProcessName)
+	}
+	return fmt.Errorf("Unknown format %q (known formats: %s)", format, strings.Join(formats, ", "))
+}
+
+// writeOutput writes to the given path, or stdout if it is empty or "-".
+func writeOutput(path string, fn func(io.Writer) error) error {
+	if path == "" || path == "-" {
+		bw := bufio.NewWriter(os.Stdout)
+		if err := fn(bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := fn(bw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
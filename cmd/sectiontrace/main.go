@@ -0,0 +1,56 @@
+// Command sectiontrace operates on trace files written by the
+// sectiontrace library, either as trace_event JSON or in the binlog
+// format.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"stats":    {"per-section aggregate statistics", runStats},
+	"tree":     {"print the reconstructed section tree", runTree},
+	"convert":  {"convert between trace formats", runConvert},
+	"critpath": {"show the critical path through each root", runCritpath},
+	"diff":     {"compare two traces", runDiff},
+	"filter":   {"keep only matching sections", runFilter},
+	"merge":    {"combine several trace files", runMerge},
+	"skew":     {"estimate clock offsets between scopes", runSkew},
+	"validate": {"check traces for structural problems", runValidate},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: sectiontrace <command> [flags] [files...]\n\nCommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nFiles default to stdin; \"-\" also means stdin.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "sectiontrace %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
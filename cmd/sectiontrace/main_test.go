@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/binlog"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func rec(name string, id int32, phase sectiontrace.Phase, ts int64, args map[string]interface{}) *sectiontrace.Record {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return &sectiontrace.Record{Name: name, ID: id, Phase: phase, TimestampMicros: ts, ProcessID: 1, Args: args}
+}
+
+func testRecords() []*sectiontrace.Record {
+	child := map[string]interface{}{"p": int32(1), "a": int32(1)}
+	return []*sectiontrace.Record{
+		rec("request", 1, sectiontrace.Begin, 0, nil),
+		rec("fetch", 2, sectiontrace.Begin, 100, child),
+		rec("fetch", 2, sectiontrace.End, 2100, map[string]interface{}{"p": int32(1), "a": int32(1), "ok": false}),
+		rec("render", 3, sectiontrace.Begin, 2200, child),
+		rec("render", 3, sectiontrace.End, 2300, map[string]interface{}{"p": int32(1), "a": int32(1), "ok": true}),
+		rec("request", 1, sectiontrace.End, 3000, map[string]interface{}{"ok": true}),
+	}
+}
+
+func writeFile(t *testing.T, name string, fn func(*os.File) error) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fn(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeJSON(t *testing.T, v interface{}) string {
+	return writeFile(t, "trace.json", func(f *os.File) error {
+		return json.NewEncoder(f).Encode(v)
+	})
+}
+
+func readOutput(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestReadFile(t *testing.T) {
+	paths := map[string]string{
+		"summary": writeJSON(t, sectiontrace.Export(testRecords())),
+		"array":   writeJSON(t, testRecords()),
+		"binlog": writeFile(t, "trace.bin", func(f *os.File) error {
+			w := binlog.NewWriter(f)
+			for _, rec := range testRecords() {
+				w.Write(rec)
+			}
+			return w.Flush()
+		}),
+	}
+	for format, path := range paths {
+		recs, err := readFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if len(recs) != 6 || recs[2].Name != "fetch" || recs[2].Args["ok"] != false {
+			t.Errorf("%s: read %d records: %+v", format, len(recs), recs)
+		}
+	}
+
+	if _, err := readFile(writeFile(t, "bad.json", func(f *os.File) error {
+		_, err := f.WriteString("{not json")
+		return err
+	})); err == nil {
+		t.Errorf("no error for malformed file")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	in := writeJSON(t, sectiontrace.Export(testRecords()))
+	out := filepath.Join(t.TempDir(), "out.json")
+	if err := runFilter([]string{"-errors", "-o", out, in}); err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := readFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]int{}
+	for _, rec := range recs {
+		names[rec.Name]++
+	}
+	if len(recs) != 4 || names["fetch"] != 2 || names["request"] != 2 {
+		t.Errorf("filtered records: %v", names)
+	}
+}
+
+func TestTree(t *testing.T) {
+	in := writeJSON(t, testRecords())
+	out := filepath.Join(t.TempDir(), "tree.txt")
+	if err := runTree([]string{"-o", out, in}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"request #1  3ms (self 900µs)",
+		"  fetch #2  2ms (self 2ms)  [failed]",
+		"  render #3  100µs (self 100µs)",
+	}
+	if got := strings.Split(strings.TrimRight(readOutput(t, out), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// capture runs fn with *stream (os.Stdout or os.Stderr) redirected to
+// a file, and returns what was written.
+func capture(t *testing.T, stream **os.File, fn func()) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "output")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *stream
+	*stream = f
+	defer func() { *stream = saved }()
+	fn()
+	f.Close()
+	return readOutput(t, path)
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	return capture(t, &os.Stdout, fn)
+}
+
+func TestReadFilesMerges(t *testing.T) {
+	a := writeJSON(t, testRecords())
+	b := writeJSON(t, testRecords())
+
+	var recs []*sectiontrace.Record
+	var err error
+	out := capture(t, &os.Stderr, func() {
+		recs, err = readFiles([]string{a, b})
+	})
+	if err != nil || len(recs) != 12 || out != "" {
+		t.Fatalf("read %d records, err = %v, stderr %q", len(recs), err, out)
+	}
+	if roots := len(tree.Build(recs).Roots); roots != 2 {
+		t.Errorf("%d roots, want one per file", roots)
+	}
+
+	twice := writeJSON(t, append(testRecords(), testRecords()...))
+	out = capture(t, &os.Stderr, func() {
+		readFiles([]string{twice})
+	})
+	if !strings.Contains(out, "ignoring 6 records") {
+		t.Errorf("duplicates not reported: %q", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	good := writeJSON(t, testRecords())
+	if out := captureStdout(t, func() {
+		if err := runValidate([]string{good}); err != nil {
+			t.Errorf("valid trace: %v", err)
+		}
+	}); out != "" {
+		t.Errorf("problems reported for valid trace: %s", out)
+	}
+
+	bad := writeJSON(t, testRecords()[:5])
+	var err error
+	out := captureStdout(t, func() {
+		err = runValidate([]string{bad})
+	})
+	if err == nil || !strings.Contains(out, "section request #1 was never closed") {
+		t.Errorf("unclosed section: err = %v, output %q", err, out)
+	}
+}
+
+func TestSkewSingleFile(t *testing.T) {
+	a := writeJSON(t, testRecords())
+	if err := runSkew([]string{a, a}); err == nil {
+		t.Errorf("no error for several files")
+	}
+}
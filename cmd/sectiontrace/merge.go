@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/merge"
+)
+
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	format := fs.String("to", "json", fmt.Sprintf("output format (%s)", strings.Join(formats, ", ")))
+	output := fs.String("o", "", "output file (default stdout)")
+	verbose := fs.Bool("v", false, "report the adjustments made to each file on stderr")
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var inputs []*sectiontrace.Summary
+	for _, path := range paths {
+		recs, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, sectiontrace.Export(recs))
+	}
+
+	merged, report := merge.Merge(inputs)
+
+	if *verbose {
+		for i, path := range paths {
+			fmt.Fprintf(os.Stderr, "%s: clock offset %v", path, report.Offsets[i])
+			var pids []int32
+			for from := range report.PIDs[i] {
+				pids = append(pids, from)
+			}
+			sort.Slice(pids, func(a, b int) bool { return pids[a] < pids[b] })
+			for _, from := range pids {
+				fmt.Fprintf(os.Stderr, ", pid %d -> %d", from, report.PIDs[i][from])
+			}
+			var scopes []string
+			for from := range report.Scopes[i] {
+				scopes = append(scopes, from)
+			}
+			sort.Strings(scopes)
+			for _, from := range scopes {
+				fmt.Fprintf(os.Stderr, ", scope %q -> %q", from, report.Scopes[i][from])
+			}
+			fmt.Fprintf(os.Stderr, "\n")
+		}
+		fmt.Fprintf(os.Stderr, "%d cross-file links, %d unresolved remote parents\n", report.Links, report.Unresolved)
+	}
+
+	return writeOutput(*output, func(w io.Writer) error {
+		return writeFormat(w, *format, merged.TraceEvents)
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace/skew"
+)
+
+func runSkew(args []string) error {
+	fs := flag.NewFlagSet("skew", flag.ExitOnError)
+	format := fs.String("to", "json", fmt.Sprintf("output format for -o (%s)", strings.Join(formats, ", ")))
+	output := fs.String("o", "", "write the corrected trace to this file")
+	fs.Parse(args)
+
+	// Several files would be merged, which already corrects their clocks.
+	if fs.NArg() > 1 {
+		return fmt.Errorf("Expected a single file, got %d (merge -v reports the offsets between files)", fs.NArg())
+	}
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	result := skew.Estimate(recs)
+
+	var scopes []string
+	for scope := range result.Offsets {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		o := result.Offsets[scope]
+		if o.Reference == scope {
+			fmt.Fprintf(os.Stdout, "%q: reference\n", scope)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%q: offset %v relative to %q, within [%v, %v] (%d pairs)\n",
+			scope, o.Offset, o.Reference, o.Lo, o.Hi, o.Pairs)
+	}
+	for _, p := range result.Inconsistent {
+		fmt.Fprintf(os.Stdout, "inconsistent: %q #%d within %q #%d needs offset in [%v, %v]\n",
+			p.ServerScope, p.ServerID, p.ClientScope, p.ClientID, p.Lo, p.Hi)
+	}
+
+	if *output == "" {
+		return nil
+	}
+	result.Apply(recs)
+	return writeOutput(*output, func(w io.Writer) error {
+		return writeFormat(w, *format, recs)
+	})
+}
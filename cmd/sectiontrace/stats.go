@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"io"
+
+	"github.com/steinarvk/sectiontrace/stats"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	snapshot := stats.FromRecords(recs)
+
+	return writeOutput(*output, func(w io.Writer) error {
+		if *asJSON {
+			return stats.WriteJSON(w, snapshot)
+		}
+		return stats.WriteText(w, snapshot)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func runTree(args []string) error {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	minDuration := fs.Duration("min", 0, "hide sections shorter than this")
+	maxDepth := fs.Int("depth", -1, "hide sections deeper than this (-1 for no limit)")
+	output := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	recs, err := readFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	t := tree.Build(recs)
+
+	return writeOutput(*output, func(w io.Writer) error {
+		var err error
+		t.Walk(func(n *tree.Node) bool {
+			if err != nil {
+				return false
+			}
+			if n.Closed() && n.Duration() < *minDuration {
+				return false
+			}
+			if *maxDepth >= 0 && n.Depth > *maxDepth {
+				return false
+			}
+			_, err = fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", n.Depth), describe(n))
+			return true
+		})
+		return err
+	})
+}
+
+func describe(n *tree.Node) string {
+	var notes []string
+	if n.Remote {
+		notes = append(notes, "remote")
+	}
+	if n.FollowsFrom != nil {
+		notes = append(notes, fmt.Sprintf("follows %s #%d", n.FollowsFrom.Name, n.FollowsFrom.ID))
+	}
+	if len(n.Links) > 0 {
+		notes = append(notes, fmt.Sprintf("links: %d", len(n.Links)))
+	}
+	if !n.OK() {
+		notes = append(notes, "failed")
+	}
+	switch {
+	case n.Begin == nil:
+		notes = append(notes, "unopened")
+	case n.End == nil:
+		notes = append(notes, "unclosed")
+	}
+
+	rv := fmt.Sprintf("%s #%d", n.Name, n.ID)
+	if n.Closed() {
+		rv += fmt.Sprintf("  %v (self %v)", round(n.Duration()), round(n.SelfTime()))
+	}
+	if len(notes) > 0 {
+		rv += "  [" + strings.Join(notes, ", ") + "]"
+	}
+	return rv
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	problems := 0
+	for _, path := range paths {
+		recs, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		report := func(format string, args ...interface{}) {
+			problems++
+			fmt.Fprintf(os.Stdout, "%s: %s\n", path, fmt.Sprintf(format, args...))
+		}
+
+		t := tree.Build(recs)
+		for _, rec := range t.Duplicates {
+			report("duplicate %q record for %s #%d", rec.Phase, rec.Name, rec.ID)
+		}
+		for _, n := range t.Unclosed {
+			report("section %s #%d was never closed", n.Name, n.ID)
+		}
+		for _, n := range t.Unopened {
+			report("section %s #%d ended without beginning", n.Name, n.ID)
+		}
+		for _, n := range t.Orphans {
+			report("section %s #%d references a missing parent", n.Name, n.ID)
+		}
+		t.Walk(func(n *tree.Node) bool {
+			if n.Closed() && n.Finish() < n.Start() {
+				report("section %s #%d ends before it begins", n.Name, n.ID)
+			}
+			if n.Begin != nil && n.End != nil && n.Begin.Name != n.End.Name {
+				report("section #%d begins as %q but ends as %q", n.ID, n.Begin.Name, n.End.Name)
+			}
+			if p := n.Parent; p != nil && !n.Remote && p.Begin != nil && n.Start() < p.Start() {
+				report("section %s #%d begins before its parent %s #%d", n.Name, n.ID, p.Name, p.ID)
+			}
+			return true
+		})
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	return nil
+}
@@ -12,6 +12,11 @@ type remoteParentScopeKey struct{}
 type remoteAncestorNodeKey struct{}
 type remoteAncestorScopeKey struct{}
 
+// The context keys below are answered by the contexts returned from this
+// package, but the library itself keeps all of its state under a single
+// internal key. Setting them directly with context.WithValue is only
+// honoured for contexts not already within a section; prefer
+// ContextWithRemoteInfo.
 var ParentNodeContextKey = parentNodeKey{}
 var AncestorNodeContextKey = ancestorNodeKey{}
 var RemoteParentNodeContextKey = remoteParentNodeKey{}
@@ -27,9 +32,46 @@ type NodeAndScope struct {
 type RemoteInfo struct {
 	Parent   NodeAndScope `json:"parent"`
 	Ancestor NodeAndScope `json:"ancestor"`
+
+	// SampledOut is set if the remote trace was not sampled, in which
+	// case Parent and Ancestor are empty.
+	SampledOut bool `json:"sampled_out,omitempty"`
+}
+
+func (info *RemoteInfo) validate() error {
+	if info.Ancestor.Scope == "" {
+		return fmt.Errorf("Missing ancestor scope")
+	}
+
+	if info.Parent.Scope == "" {
+		return fmt.Errorf("Missing parent scope")
+	}
+
+	if info.Parent.ID == 0 {
+		return fmt.Errorf("Missing parent ID")
+	}
+
+	if info.Ancestor.ID == 0 {
+		return fmt.Errorf("Missing ancestor ID")
+	}
+
+	return nil
 }
 
 func RemoteInfoFromContext(ctx context.Context) (*RemoteInfo, error) {
+	if s, ok := ctx.Value(sectionStateKey{}).(*sectionState); ok {
+		if s.sampledOut {
+			return &RemoteInfo{SampledOut: true}, nil
+		}
+		if !s.hasRemoteParent() {
+			return nil, s.err
+		}
+		return s.remote, s.err
+	}
+	return remoteInfoFromKeys(ctx)
+}
+
+func remoteInfoFromKeys(ctx context.Context) (*RemoteInfo, error) {
 	var rv RemoteInfo
 
 	if v := ctx.Value(RemoteParentNodeContextKey); v != nil {
@@ -70,32 +112,79 @@ func RemoteInfoFromContext(ctx context.Context) (*RemoteInfo, error) {
 		return nil, nil
 	}
 
-	if rv.Ancestor.Scope == "" {
-		return nil, fmt.Errorf("Missing ancestor scope")
+	if err := rv.validate(); err != nil {
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+func ContextWithRemoteInfo(ctx context.Context, info *RemoteInfo) context.Context {
+	if info == nil {
+		return ctx
+	}
+	if info.SampledOut {
+		return withSampledOut(ctx)
 	}
 
-	if rv.Parent.Scope == "" {
-		return nil, fmt.Errorf("Missing parent scope")
+	state, err := stateFromContext(ctx)
+	remote := *info
+	state.remote = &remote
+	if err == nil {
+		err = remote.validate()
 	}
+	state.err = err
+	return &stateContext{Context: ctx, state: state}
+}
 
-	if rv.Parent.ID == 0 {
-		return nil, fmt.Errorf("Missing parent ID")
+// OutgoingRemoteInfo returns the RemoteInfo to send along with a request
+// made from within the section ctx belongs to, or nil if there is none.
+func OutgoingRemoteInfo(ctx context.Context) *RemoteInfo {
+	state, err := stateFromContext(ctx)
+	if err != nil {
+		return nil
+	}
+	if state.sampledOut {
+		return &RemoteInfo{SampledOut: true}
 	}
+	if !state.hasParent {
+		return nil
+	}
+	rv := &RemoteInfo{Parent: NodeAndScope{Scope: DefaultScope, ID: state.parent}}
+	if state.remote != nil {
+		rv.Ancestor = state.remote.Ancestor
+	} else {
+		rv.Ancestor = NodeAndScope{Scope: DefaultScope, ID: state.ancestor}
+	}
+	return rv
+}
 
-	if rv.Ancestor.ID == 0 {
-		return nil, fmt.Errorf("Missing ancestor ID")
+// CurrentSection returns the innermost section ctx was returned from,
+// which is the parent of any section begun from ctx.
+func CurrentSection(ctx context.Context) (NodeAndScope, bool) {
+	id, ok := ParentID(ctx)
+	if !ok {
+		return NodeAndScope{}, false
 	}
+	return NodeAndScope{Scope: DefaultScope, ID: id}, true
+}
 
-	return &rv, nil
+// ParentID returns the ID that sections begun from ctx record as their
+// parent (the "p" arg).
+func ParentID(ctx context.Context) (int32, bool) {
+	state, err := stateFromContext(ctx)
+	if err != nil || !state.hasParent {
+		return 0, false
+	}
+	return state.parent, true
 }
 
-func ContextWithRemoteInfo(ctx context.Context, info *RemoteInfo) context.Context {
-	if info == nil {
-		return ctx
+// RootID returns the ID of the outermost local section ctx belongs to,
+// which sections begun from ctx record as their ancestor (the "a" arg).
+func RootID(ctx context.Context) (int32, bool) {
+	state, err := stateFromContext(ctx)
+	if err != nil || !state.hasAncestor {
+		return 0, false
 	}
-	ctx = context.WithValue(ctx, RemoteParentNodeContextKey, info.Parent.ID)
-	ctx = context.WithValue(ctx, RemoteParentScopeContextKey, info.Parent.Scope)
-	ctx = context.WithValue(ctx, RemoteAncestorNodeContextKey, info.Ancestor.ID)
-	ctx = context.WithValue(ctx, RemoteAncestorScopeContextKey, info.Ancestor.Scope)
-	return ctx
+	return state.ancestor, true
 }
@@ -0,0 +1,99 @@
+package sectiontrace
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestContextAccessors(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 0
+
+	ctx := context.Background()
+	if _, ok := CurrentSection(ctx); ok {
+		t.Errorf("CurrentSection outside of any section")
+	}
+
+	_ = New("outer").Do(ctx, func(ctx context.Context) error {
+		return New("inner").Do(ctx, func(ctx context.Context) error {
+			if cur, ok := CurrentSection(ctx); !ok || cur != (NodeAndScope{Scope: "testscope", ID: 2}) {
+				t.Errorf("CurrentSection = %v, %v", cur, ok)
+			}
+			if id, ok := ParentID(ctx); !ok || id != 2 {
+				t.Errorf("ParentID = %v, %v", id, ok)
+			}
+			if id, ok := RootID(ctx); !ok || id != 1 {
+				t.Errorf("RootID = %v, %v", id, ok)
+			}
+
+			// The exported keys still work.
+			if v := ctx.Value(ParentNodeContextKey); v != int32(2) {
+				t.Errorf("ParentNodeContextKey = %v", v)
+			}
+			if v := ctx.Value(AncestorNodeContextKey); v != int32(1) {
+				t.Errorf("AncestorNodeContextKey = %v", v)
+			}
+			return nil
+		})
+	})
+}
+
+func TestContextRemoteInfo(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 0
+
+	info := &RemoteInfo{
+		Parent:   NodeAndScope{Scope: "client", ID: 7},
+		Ancestor: NodeAndScope{Scope: "client", ID: 5},
+	}
+	ctx := ContextWithRemoteInfo(context.Background(), info)
+	if v := ctx.Value(RemoteParentScopeContextKey); v != "client" {
+		t.Errorf("RemoteParentScopeContextKey = %v", v)
+	}
+
+	_ = New("server").Do(ctx, func(ctx context.Context) error {
+		got, err := RemoteInfoFromContext(ctx)
+		if err != nil || got == nil || *got != *info {
+			t.Errorf("RemoteInfoFromContext = %+v, %v", got, err)
+		}
+		out := OutgoingRemoteInfo(ctx)
+		if out == nil || out.Parent.ID != 1 || out.Ancestor != info.Ancestor {
+			t.Errorf("OutgoingRemoteInfo = %+v", out)
+		}
+		return nil
+	})
+
+	args := collectedRecords[0].AllArgs()
+	if args[ArgRemoteParent] != int32(7) || args[ArgRemoteAncestorScope] != "client" {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestContextLegacyKeys(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 10
+
+	// Code predating ContextWithRemoteInfo set the keys directly.
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, ParentNodeContextKey, int32(3))
+	ctx = context.WithValue(ctx, AncestorNodeContextKey, int32(2))
+	ctx = context.WithValue(ctx, RemoteParentNodeContextKey, int32(7))
+	ctx = context.WithValue(ctx, RemoteParentScopeContextKey, "client")
+	ctx = context.WithValue(ctx, RemoteAncestorNodeContextKey, int32(5))
+	ctx = context.WithValue(ctx, RemoteAncestorScopeContextKey, "client")
+
+	if id, ok := RootID(ctx); !ok || id != 2 {
+		t.Errorf("RootID = %v, %v", id, ok)
+	}
+
+	_ = New("legacy").Do(ctx, func(ctx context.Context) error { return nil })
+
+	args := collectedRecords[0].AllArgs()
+	if args[ArgParent] != int32(3) || args[ArgAncestor] != int32(2) || args[ArgRemoteParent] != int32(7) {
+		t.Errorf("args = %v", args)
+	}
+}
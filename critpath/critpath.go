@@ -0,0 +1,199 @@
+// Package critpath computes the critical path through a section tree:
+// the chain of sections that actually determined when the root ended.
+package critpath
+
+import (
+	"sort"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// ArgCriticalPath is set by Annotate to a section's contribution to the
+// critical path, in microseconds.
+const ArgCriticalPath = sectiontrace.ArgCriticalPath
+
+// Category, Scope and the first ID of the synthetic records produced
+// by Records.
+var (
+	Category       = "CriticalPath"
+	Scope          = "critpath"
+	FirstID  int32 = 1
+)
+
+// Segment is a stretch of the critical path spent in the section's own
+// code rather than waiting for any child.
+type Segment struct {
+	Node          *tree.Node
+	Start, Finish int64
+}
+
+func (s Segment) Duration() time.Duration {
+	return time.Duration(s.Finish-s.Start) * time.Microsecond
+}
+
+// Path is the critical path through one root section.
+type Path struct {
+	Root *tree.Node
+	// Segments are in time order. Consecutive segments belong to
+	// different sections.
+	Segments []Segment
+}
+
+// Compute finds the critical path through a closed section. Starting
+// from the end of a section, the path steps into the child that ended
+// last, then continues from that child's start. Children running
+// concurrently with the chosen one, but ending before it, are skipped:
+// they did not delay the parent.
+func Compute(root *tree.Node) *Path {
+	p := &Path{Root: root}
+	if root.Closed() {
+		p.walk(root, root.Start(), root.Finish())
+	}
+	for i, j := 0, len(p.Segments)-1; i < j; i, j = i+1, j-1 {
+		p.Segments[i], p.Segments[j] = p.Segments[j], p.Segments[i]
+	}
+	return p
+}
+
+// ComputeTree computes the critical path for every closed root.
+func ComputeTree(t *tree.Tree) []*Path {
+	var rv []*Path
+	for _, root := range t.Roots {
+		if root.Closed() {
+			rv = append(rv, Compute(root))
+		}
+	}
+	return rv
+}
+
+// add appends a segment, in reverse time order.
+func (p *Path) add(n *tree.Node, start, finish int64) {
+	if finish <= start {
+		return
+	}
+	if last := len(p.Segments) - 1; last >= 0 && p.Segments[last].Node == n && p.Segments[last].Start == finish {
+		p.Segments[last].Start = start
+		return
+	}
+	p.Segments = append(p.Segments, Segment{Node: n, Start: start, Finish: finish})
+}
+
+// walk adds the critical path of n within [lo, hi], backwards.
+func (p *Path) walk(n *tree.Node, lo, hi int64) {
+	children := make([]*tree.Node, 0, len(n.Children))
+	for _, c := range n.Children {
+		if c.Closed() {
+			children = append(children, c)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Finish() > children[j].Finish()
+	})
+
+	cursor := hi
+	for cursor > lo {
+		var next *tree.Node
+		for _, c := range children {
+			if c.Start() < cursor && c.Finish() > lo {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		end := next.Finish()
+		if end > cursor {
+			end = cursor
+		}
+		start := next.Start()
+		if start < lo {
+			start = lo
+		}
+		p.add(n, end, cursor)
+		p.walk(next, start, end)
+		cursor = start
+	}
+	p.add(n, lo, cursor)
+}
+
+// Duration is the total length of the path, which is the duration of
+// the root.
+func (p *Path) Duration() time.Duration {
+	var rv time.Duration
+	for _, s := range p.Segments {
+		rv += s.Duration()
+	}
+	return rv
+}
+
+// Contributions returns the time each section spent on the path.
+func (p *Path) Contributions() map[*tree.Node]time.Duration {
+	rv := map[*tree.Node]time.Duration{}
+	for _, s := range p.Segments {
+		rv[s.Node] += s.Duration()
+	}
+	return rv
+}
+
+// Chain returns the sections on the path, in the order they first
+// appear on it.
+func (p *Path) Chain() []*tree.Node {
+	var rv []*tree.Node
+	seen := map[*tree.Node]bool{}
+	for _, s := range p.Segments {
+		if !seen[s.Node] {
+			seen[s.Node] = true
+			rv = append(rv, s.Node)
+		}
+	}
+	return rv
+}
+
+// Annotate sets ArgCriticalPath on the end records of the sections on
+// the paths. The records are modified in place.
+func Annotate(paths ...*Path) {
+	for _, p := range paths {
+		for n, d := range p.Contributions() {
+			if n.End.Args == nil {
+				n.End.Args = map[string]interface{}{}
+			}
+			n.End.Args[ArgCriticalPath] = d.Microseconds()
+		}
+	}
+}
+
+// Records returns synthetic begin and end records, one pair for each
+// segment of the paths, named after the section the segment belongs
+// to. Added to a trace, they show the critical path as a separate lane
+// in the root's process.
+func Records(paths ...*Path) []*sectiontrace.Record {
+	var rv []*sectiontrace.Record
+	id := FirstID
+	for _, p := range paths {
+		pid := p.Root.Begin.ProcessID
+		for _, s := range p.Segments {
+			begin := &sectiontrace.Record{
+				Category:        Category,
+				Name:            s.Node.Name,
+				Phase:           sectiontrace.Begin,
+				Scope:           Scope,
+				TimestampMicros: s.Start,
+				ID:              id,
+				ProcessID:       pid,
+				Args: map[string]interface{}{
+					"section":       s.Node.ID,
+					"section_scope": s.Node.Scope,
+				},
+			}
+			end := *begin
+			end.Phase = sectiontrace.End
+			end.TimestampMicros = s.Finish
+			rv = append(rv, begin, &end)
+			id++
+		}
+	}
+	return rv
+}
@@ -0,0 +1,97 @@
+package critpath
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func pair(name string, id, parent int32, t0, t1 int64) []*sectiontrace.Record {
+	args := map[string]interface{}{}
+	endArgs := map[string]interface{}{"ok": true}
+	if parent != 0 {
+		args["p"] = parent
+		endArgs["p"] = parent
+	}
+	return []*sectiontrace.Record{
+		{Name: name, ID: id, Phase: sectiontrace.Begin, TimestampMicros: t0, Args: args},
+		{Name: name, ID: id, Phase: sectiontrace.End, TimestampMicros: t1, Args: endArgs},
+	}
+}
+
+func build(pairs ...[]*sectiontrace.Record) *tree.Tree {
+	var recs []*sectiontrace.Record
+	for _, p := range pairs {
+		recs = append(recs, p...)
+	}
+	return tree.Build(recs)
+}
+
+func TestCompute(t *testing.T) {
+	// A root fans out to three concurrent workers, the slowest of which
+	// makes a call, and then does some final work.
+	tr := build(
+		pair("root", 1, 0, 0, 1000),
+		pair("worker", 2, 1, 100, 400),
+		pair("worker", 3, 1, 100, 700),
+		pair("call", 5, 3, 300, 600),
+		pair("worker", 4, 1, 150, 500),
+		pair("finish", 6, 1, 800, 900),
+	)
+	root := tr.Lookup("", 1)
+	p := Compute(root)
+
+	type seg struct {
+		id     int32
+		t0, t1 int64
+	}
+	want := []seg{{1, 0, 100}, {3, 100, 300}, {5, 300, 600}, {3, 600, 700}, {1, 700, 800}, {6, 800, 900}, {1, 900, 1000}}
+	if len(p.Segments) != len(want) {
+		t.Fatalf("segments = %+v", p.Segments)
+	}
+	for i, s := range p.Segments {
+		if (seg{s.Node.ID, s.Start, s.Finish}) != want[i] {
+			t.Errorf("segment %d = %d [%d, %d] want %+v", i, s.Node.ID, s.Start, s.Finish, want[i])
+		}
+	}
+	if p.Duration() != root.Duration() {
+		t.Errorf("path duration = %v want %v", p.Duration(), root.Duration())
+	}
+
+	var chain []int32
+	for _, n := range p.Chain() {
+		chain = append(chain, n.ID)
+	}
+	if len(chain) != 4 || chain[0] != 1 || chain[1] != 3 || chain[2] != 5 || chain[3] != 6 {
+		t.Errorf("chain = %v", chain)
+	}
+	if got := p.Contributions()[tr.Lookup("", 3)]; got != 300*time.Microsecond {
+		t.Errorf("worker 3 contribution = %v", got)
+	}
+
+	Annotate(p)
+	if v, ok := tr.Lookup("", 5).End.Args[ArgCriticalPath]; !ok || v != int64(300) {
+		t.Errorf("call annotation = %v", v)
+	}
+	if _, ok := tr.Lookup("", 2).End.Args[ArgCriticalPath]; ok {
+		t.Errorf("worker 2 annotated although it is not on the path")
+	}
+
+	lane := Records(p)
+	if len(lane) != 2*len(want) || lane[0].Category != Category || lane[0].Scope != Scope {
+		t.Errorf("lane records = %+v", lane)
+	}
+}
+
+func TestUnclosedChild(t *testing.T) {
+	tr := build(
+		pair("root", 1, 0, 0, 100),
+		[]*sectiontrace.Record{{Name: "hung", ID: 2, Phase: sectiontrace.Begin, TimestampMicros: 10, Args: map[string]interface{}{"p": int32(1)}}},
+	)
+	p := Compute(tr.Lookup("", 1))
+	if len(p.Segments) != 1 || p.Segments[0].Duration() != 100*time.Microsecond {
+		t.Errorf("segments = %+v", p.Segments)
+	}
+}
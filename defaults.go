@@ -1,6 +1,9 @@
 package sectiontrace
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+)
 
 var DebugMode bool = false
 
@@ -8,6 +11,7 @@ var DefaultCategory string = "Section"
 var DefaultScope string = ""
 
 var ProcessID int32 = int32(os.Getpid())
+var ProcessName string = filepath.Base(os.Args[0])
 
 var DefaultDisplayTimeUnit string = "ms"
 var DefaultOtherData = map[string]interface{}{}
@@ -0,0 +1,40 @@
+package sectiontrace
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of its parent, but not its deadline
+// or cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// Detach returns a context for background work started by the section
+// ctx belongs to, which may outlive it. Sections begun from the returned
+// context are not nested in that section, but record it in the
+// ArgFollowsFrom arg, and stay in the same trace. The context keeps the
+// values of ctx, but is never cancelled.
+func Detach(ctx context.Context) context.Context {
+	detached := detachedContext{ctx}
+
+	state, err := stateFromContext(ctx)
+	if err == nil && state.sampledOut {
+		return withSampledOut(detached)
+	}
+
+	rv := &stateContext{Context: detached}
+	rv.state.followsFrom, rv.state.hasFollowsFrom = state.parent, state.hasParent
+	rv.state.ancestor, rv.state.hasAncestor = state.ancestor, state.hasAncestor
+	if state.remote != nil {
+		rv.state.remote = &RemoteInfo{Ancestor: state.remote.Ancestor}
+	}
+	rv.state.err = err
+	return rv
+}
@@ -0,0 +1,93 @@
+package sectiontrace
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetach(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 0
+
+	parentCtx, cancel := context.WithCancel(context.Background())
+	var detached context.Context
+	_ = New("request").Do(parentCtx, func(ctx context.Context) error {
+		detached = Detach(ctx)
+		return nil
+	})
+	cancel()
+
+	if detached.Err() != nil {
+		t.Errorf("detached context cancelled along with its parent")
+	}
+	if _, ok := ParentID(detached); ok {
+		t.Errorf("detached context has a parent")
+	}
+
+	currentTestTime = currentTestTime.Add(time.Second)
+	_ = New("refresh").Do(detached, func(ctx context.Context) error {
+		if id, ok := ParentID(ctx); !ok || id != 2 {
+			t.Errorf("ParentID within detached section = %v, %v", id, ok)
+		}
+		return nil
+	})
+
+	begin := collectedRecords[2]
+	if begin.Name != "refresh" || begin.AllArgs()[ArgFollowsFrom] != int32(1) {
+		t.Fatalf("detached begin record = %+v", begin)
+	}
+	if _, ok := begin.AllArgs()[ArgParent]; ok {
+		t.Errorf("detached section has a parent: %v", begin.AllArgs())
+	}
+
+	events := Export(collectedRecords).TraceEvents
+	if len(events) != 6 {
+		t.Fatalf("got %d events, want 4 records and 2 flow events", len(events))
+	}
+	start, end := events[3], events[4]
+	if start.Phase != FlowStart || end.Phase != FlowEnd || start.ID != end.ID {
+		t.Errorf("flow events = %+v, %+v", start, end)
+	}
+	if start.TimestampMicros != 1230000000 || end.TimestampMicros != 1231000000 {
+		t.Errorf("flow from %d to %d", start.TimestampMicros, end.TimestampMicros)
+	}
+
+	// Exporting again does not duplicate the flow events.
+	if again := Export(events).TraceEvents; len(again) != 6 {
+		t.Errorf("re-export has %d events", len(again))
+	}
+}
+
+func TestDetachKeepsTrace(t *testing.T) {
+	collectedRecords = nil
+	nextNodeID = 0
+
+	ctx := ContextWithRemoteInfo(context.Background(), &RemoteInfo{
+		Parent:   NodeAndScope{Scope: "client", ID: 7},
+		Ancestor: NodeAndScope{Scope: "client", ID: 5},
+	})
+	_ = New("serve").Do(ctx, func(ctx context.Context) error {
+		detached := Detach(ctx)
+		if info, err := RemoteInfoFromContext(detached); info != nil || err != nil {
+			t.Errorf("detached context has remote parent %+v, %v", info, err)
+		}
+		return New("refresh").Do(detached, func(context.Context) error { return nil })
+	})
+
+	begin := collectedRecords[1]
+	if begin.Name != "refresh" {
+		t.Fatalf("unexpected record %+v", begin)
+	}
+	want := map[string]interface{}{
+		ArgFollowsFrom:         int32(1),
+		ArgAncestor:            int32(1),
+		ArgRemoteAncestor:      int32(5),
+		ArgRemoteAncestorScope: "client",
+	}
+	if !reflect.DeepEqual(begin.AllArgs(), want) {
+		t.Errorf("detached begin args = %v, want %v", begin.AllArgs(), want)
+	}
+}
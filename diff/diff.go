@@ -0,0 +1,151 @@
+// Package diff compares two traces, or two sets of aggregate statistics,
+// to find regressions.
+package diff
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/stats"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// Change describes how the statistics for one section name changed.
+// A name missing from one side has empty statistics on that side.
+type Change struct {
+	Name          string
+	Before, After *stats.Stats
+
+	// CountZ is the z-score of the change in count, treating counts as
+	// Poisson distributed. MeanZ is the z-score of the change in mean
+	// duration (Welch's test), with variances estimated from the
+	// histograms.
+	CountZ float64
+	MeanZ  float64
+}
+
+func (c *Change) CountDelta() int64 {
+	return c.After.Count - c.Before.Count
+}
+
+func (c *Change) TotalDelta() time.Duration {
+	return c.After.Total - c.Before.Total
+}
+
+func (c *Change) SelfDelta() time.Duration {
+	return c.After.Self - c.Before.Self
+}
+
+func (c *Change) MeanDelta() time.Duration {
+	return c.After.Mean() - c.Before.Mean()
+}
+
+func (c *Change) QuantileDelta(q float64) time.Duration {
+	return c.After.Duration.Quantile(q) - c.Before.Duration.Quantile(q)
+}
+
+// Significant reports whether either the count or the mean duration
+// changed by at least z standard errors.
+func (c *Change) Significant(z float64) bool {
+	return math.Abs(c.CountZ) >= z || math.Abs(c.MeanZ) >= z
+}
+
+func emptyStats(name string) *stats.Stats {
+	return &stats.Stats{Name: name, Duration: &stats.Histogram{}}
+}
+
+// variance estimates the variance of durations, in microseconds
+// squared, treating values as uniformly distributed within each bucket.
+func variance(s *stats.Stats) float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	mean := float64(s.Mean().Microseconds())
+	var sum float64
+	var n int64
+	s.Duration.Buckets(func(lo, hi time.Duration, count int64) {
+		l, h := float64(lo.Microseconds()), float64(hi.Microseconds()+1)
+		mid := (l + h) / 2
+		width := h - l
+		sum += float64(count) * ((mid-mean)*(mid-mean) + width*width/12)
+		n += count
+	})
+	if n < 2 {
+		return 0
+	}
+	return sum / float64(n-1)
+}
+
+func countZ(before, after int64) float64 {
+	if before+after == 0 {
+		return 0
+	}
+	return float64(after-before) / math.Sqrt(float64(before+after))
+}
+
+func meanZ(before, after *stats.Stats) float64 {
+	if before.Count < 2 || after.Count < 2 {
+		return 0
+	}
+	se := math.Sqrt(variance(before)/float64(before.Count) + variance(after)/float64(after.Count))
+	if se == 0 {
+		return 0
+	}
+	return float64(after.Mean().Microseconds()-before.Mean().Microseconds()) / se
+}
+
+// Compare matches statistics by name. Changes are sorted by the absolute
+// change in total time, largest first.
+func Compare(before, after []*stats.Stats) []*Change {
+	byName := map[string]*Change{}
+	get := func(name string) *Change {
+		c, ok := byName[name]
+		if !ok {
+			c = &Change{Name: name, Before: emptyStats(name), After: emptyStats(name)}
+			byName[name] = c
+		}
+		return c
+	}
+	for _, s := range before {
+		get(s.Name).Before = s
+	}
+	for _, s := range after {
+		get(s.Name).After = s
+	}
+
+	rv := make([]*Change, 0, len(byName))
+	for _, c := range byName {
+		c.CountZ = countZ(c.Before.Count, c.After.Count)
+		c.MeanZ = meanZ(c.Before, c.After)
+		rv = append(rv, c)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		di, dj := rv[i].TotalDelta(), rv[j].TotalDelta()
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		if di != dj {
+			return di > dj
+		}
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// CompareRecords compares the statistics of two traces.
+func CompareRecords(before, after []*sectiontrace.Record) []*Change {
+	return Compare(stats.FromRecords(before), stats.FromRecords(after))
+}
+
+// CompareTrees compares the statistics of two reconstructed trees.
+func CompareTrees(before, after *tree.Tree) []*Change {
+	a, b := stats.NewAggregator(), stats.NewAggregator()
+	a.AddTree(before)
+	b.AddTree(after)
+	return Compare(a.Snapshot(), b.Snapshot())
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/stats"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// run generates n requests, each with a child "query" of the given
+// duration in microseconds.
+func run(n int, query int64) []*sectiontrace.Record {
+	var recs []*sectiontrace.Record
+	ts := int64(0)
+	for i := 0; i < n; i++ {
+		root, child := int32(2*i+1), int32(2*i+2)
+		jitter := int64(i % 7)
+		args := map[string]interface{}{"p": root, "a": root}
+		recs = append(recs,
+			&sectiontrace.Record{Name: "request", ID: root, Phase: sectiontrace.Begin, TimestampMicros: ts, Args: map[string]interface{}{}},
+			&sectiontrace.Record{Name: "query", ID: child, Phase: sectiontrace.Begin, TimestampMicros: ts + 10, Args: args},
+			&sectiontrace.Record{Name: "query", ID: child, Phase: sectiontrace.End, TimestampMicros: ts + 10 + query + jitter, Args: args},
+			&sectiontrace.Record{Name: "request", ID: root, Phase: sectiontrace.End, TimestampMicros: ts + 20 + query + jitter, Args: map[string]interface{}{}},
+		)
+		ts += 10000
+	}
+	return recs
+}
+
+func TestCompare(t *testing.T) {
+	before, after := run(100, 1000), run(100, 1500)
+
+	changes := CompareRecords(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %d", len(changes))
+	}
+	for _, c := range changes {
+		if c.CountDelta() != 0 || c.CountZ != 0 {
+			t.Errorf("%s: count changed: %d (z=%v)", c.Name, c.CountDelta(), c.CountZ)
+		}
+		if got, want := c.TotalDelta(), 50*time.Millisecond; got != want {
+			t.Errorf("%s: total delta = %v want %v", c.Name, got, want)
+		}
+		if !c.Significant(10) {
+			t.Errorf("%s: mean change not significant: z=%v", c.Name, c.MeanZ)
+		}
+	}
+	if changes[0].Name != "query" || changes[0].SelfDelta() != 50*time.Millisecond {
+		t.Errorf("first change = %s with self delta %v", changes[0].Name, changes[0].SelfDelta())
+	}
+
+	same := CompareRecords(before, run(100, 1000))
+	for _, c := range same {
+		if c.Significant(1) {
+			t.Errorf("%s: identical runs considered different: %+v", c.Name, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "+50ms") {
+		t.Errorf("report lacks total delta:\n%s", buf.String())
+	}
+}
+
+func TestCompareMissing(t *testing.T) {
+	changes := Compare(nil, stats.FromRecords(run(4, 100)))
+	for _, c := range changes {
+		if c.Before.Count != 0 || c.After.Count != 4 || c.CountZ != 2 {
+			t.Errorf("%s: %+v", c.Name, c)
+		}
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFolded(&buf, tree.Build(run(1, 1000)), tree.Build(run(1, 2000))); err != nil {
+		t.Fatal(err)
+	}
+	want := "request 20 20\nrequest;query 1000 2000\n"
+	if buf.String() != want {
+		t.Errorf("got %q want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/steinarvk/sectiontrace/flamegraph"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+type jsonChange struct {
+	Name         string  `json:"name"`
+	CountBefore  int64   `json:"count_before"`
+	CountAfter   int64   `json:"count_after"`
+	TotalBefore  int64   `json:"total_us_before"`
+	TotalAfter   int64   `json:"total_us_after"`
+	SelfBefore   int64   `json:"self_us_before"`
+	SelfAfter    int64   `json:"self_us_after"`
+	MeanBefore   int64   `json:"mean_us_before"`
+	MeanAfter    int64   `json:"mean_us_after"`
+	P50Before    int64   `json:"p50_us_before"`
+	P50After     int64   `json:"p50_us_after"`
+	P99Before    int64   `json:"p99_us_before"`
+	P99After     int64   `json:"p99_us_after"`
+	ErrorsBefore int64   `json:"errors_before"`
+	ErrorsAfter  int64   `json:"errors_after"`
+	CountZ       float64 `json:"count_z"`
+	MeanZ        float64 `json:"mean_z"`
+}
+
+// WriteJSON writes the changes as a JSON array, in the given order.
+func WriteJSON(w io.Writer, changes []*Change) error {
+	out := []jsonChange{}
+	for _, c := range changes {
+		out = append(out, jsonChange{
+			Name:         c.Name,
+			CountBefore:  c.Before.Count,
+			CountAfter:   c.After.Count,
+			TotalBefore:  c.Before.Total.Microseconds(),
+			TotalAfter:   c.After.Total.Microseconds(),
+			SelfBefore:   c.Before.Self.Microseconds(),
+			SelfAfter:    c.After.Self.Microseconds(),
+			MeanBefore:   c.Before.Mean().Microseconds(),
+			MeanAfter:    c.After.Mean().Microseconds(),
+			P50Before:    c.Before.Duration.Quantile(0.5).Microseconds(),
+			P50After:     c.After.Duration.Quantile(0.5).Microseconds(),
+			P99Before:    c.Before.Duration.Quantile(0.99).Microseconds(),
+			P99After:     c.After.Duration.Quantile(0.99).Microseconds(),
+			ErrorsBefore: c.Before.Errors,
+			ErrorsAfter:  c.After.Errors,
+			CountZ:       c.CountZ,
+			MeanZ:        c.MeanZ,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func signed(d time.Duration) string {
+	switch {
+	case d >= time.Second || d <= -time.Second:
+		d = d.Round(time.Millisecond)
+	case d >= time.Millisecond || d <= -time.Millisecond:
+		d = d.Round(10 * time.Microsecond)
+	}
+	if d > 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+// WriteText writes the changes as a table, in the given order. Changes
+// significant at z >= 3 are marked with an asterisk.
+func WriteText(w io.Writer, changes []*Change) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "count\tΔcount\tΔtotal\tΔself\tΔmean\tΔp50\tΔp99\tz(count)\tz(mean)\t  name\n")
+	for _, c := range changes {
+		mark := ""
+		if c.Significant(3) {
+			mark = " *"
+		}
+		fmt.Fprintf(tw, "%d→%d\t%+d\t%s\t%s\t%s\t%s\t%s\t%.1f\t%.1f\t  %s%s\n",
+			c.Before.Count, c.After.Count, c.CountDelta(),
+			signed(c.TotalDelta()), signed(c.SelfDelta()), signed(c.MeanDelta()),
+			signed(c.QuantileDelta(0.5)), signed(c.QuantileDelta(0.99)),
+			c.CountZ, c.MeanZ, c.Name, mark)
+	}
+	return tw.Flush()
+}
+
+// WriteFolded writes a differential flame graph in the format produced
+// by difffolded.pl: each stack followed by its self time in
+// microseconds before and after. flamegraph.pl colours such input by
+// the change.
+func WriteFolded(w io.Writer, before, after *tree.Tree) error {
+	a, b := flamegraph.Fold(before), flamegraph.Fold(after)
+	stacks := map[string]bool{}
+	for stack := range a {
+		stacks[stack] = true
+	}
+	for stack := range b {
+		stacks[stack] = true
+	}
+	sorted := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		sorted = append(sorted, stack)
+	}
+	sort.Strings(sorted)
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range sorted {
+		fmt.Fprintf(bw, "%s %d %d\n", stack, a[stack], b[stack])
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,80 @@
+package expvars
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// Publisher is a sectiontrace.Sink that publishes per-section counters
+// through expvar, so they show up under /debug/vars.
+//
+// The published map has the following entries, each of which is itself
+// a map keyed by section name, except for the overhead counters:
+//
+//	calls          number of sections ended
+//	errors         number of sections ended with an error
+//	duration_us    cumulative time spent in sections
+//	open           number of sections currently open
+//	overhead_ns    time spent inside the library (requires OnTimeSpent)
+//	timed          number of sections counted in overhead_ns
+type Publisher struct {
+	calls    *expvar.Map
+	errors   *expvar.Map
+	duration *expvar.Map
+	open     *expvar.Map
+	overhead *expvar.Int
+	timed    *expvar.Int
+}
+
+// Publish creates a Publisher whose counters are published under the
+// given expvar name. Like expvar.Publish, it panics if the name is
+// already in use.
+func Publish(name string) *Publisher {
+	p := &Publisher{
+		calls:    new(expvar.Map).Init(),
+		errors:   new(expvar.Map).Init(),
+		duration: new(expvar.Map).Init(),
+		open:     new(expvar.Map).Init(),
+		overhead: new(expvar.Int),
+		timed:    new(expvar.Int),
+	}
+
+	m := expvar.NewMap(name)
+	m.Set("calls", p.calls)
+	m.Set("errors", p.errors)
+	m.Set("duration_us", p.duration)
+	m.Set("open", p.open)
+	m.Set("overhead_ns", p.overhead)
+	m.Set("timed", p.timed)
+
+	return p
+}
+
+func (p *Publisher) OnBegin(begin *sectiontrace.Record) {
+	p.open.Add(begin.Name, 1)
+}
+
+func (p *Publisher) OnEnd(begin, end *sectiontrace.Record) {
+	p.open.Add(end.Name, -1)
+	p.calls.Add(end.Name, 1)
+	if ok, _ := end.BoolArg(sectiontrace.ArgOK); !ok {
+		p.errors.Add(end.Name, 1)
+	}
+	p.duration.Add(end.Name, end.TimestampMicros-begin.TimestampMicros)
+}
+
+// OnTimeSpent is suitable for use as sectiontrace.OnTimeSpent.
+func (p *Publisher) OnTimeSpent(overhead, internal time.Duration, hadParent bool) {
+	p.overhead.Add(int64(overhead))
+	p.timed.Add(1)
+}
+
+// Install installs the publisher as the OnTimeSpent hook and as a sink,
+// along with any other sinks given. Like sectiontrace.InstallSinks, it
+// replaces all sinks installed before, so pass any that should be kept.
+func (p *Publisher) Install(others ...sectiontrace.Sink) {
+	sectiontrace.InstallSinks(append([]sectiontrace.Sink{p}, others...)...)
+	sectiontrace.OnTimeSpent = p.OnTimeSpent
+}
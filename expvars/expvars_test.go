@@ -0,0 +1,49 @@
+package expvars
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// runs makes the published name unique when the tests are run several
+// times in one process, since expvar names cannot be reused.
+var runs int
+
+func TestPublish(t *testing.T) {
+	runs++
+	name := fmt.Sprintf("sectiontrace_test_%d", runs)
+	p := Publish(name)
+
+	begin := &sectiontrace.Record{Name: "a", Phase: sectiontrace.Begin, TimestampMicros: 100, Args: map[string]interface{}{}}
+	end := &sectiontrace.Record{Name: "a", Phase: sectiontrace.End, TimestampMicros: 350, Args: map[string]interface{}{"ok": false}}
+
+	p.OnBegin(begin)
+	p.OnBegin(begin)
+	p.OnEnd(begin, end)
+	p.OnTimeSpent(3*time.Microsecond, time.Millisecond, false)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{
+		"calls":       1,
+		"errors":      1,
+		"duration_us": 250,
+		"open":        1,
+	}
+	for key, value := range want {
+		if m, _ := got[key].(map[string]interface{}); m["a"] != value {
+			t.Errorf("%s = %v want %v", key, got[key], value)
+		}
+	}
+	if got["overhead_ns"] != float64(3000) || got["timed"] != float64(1) {
+		t.Errorf("overhead = %v timed = %v", got["overhead_ns"], got["timed"])
+	}
+}
@@ -0,0 +1,130 @@
+package flamegraph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// Separator joins frames in folded stacks.
+const Separator = ";"
+
+var frameEscaper = strings.NewReplacer(Separator, "_", "\n", " ")
+
+// Fold aggregates the self time of every closed section by its stack of
+// section names, in microseconds. Stacks are keyed by the names from the
+// root down, joined by Separator.
+func Fold(t *tree.Tree) map[string]int64 {
+	rv := map[string]int64{}
+	t.Walk(func(n *tree.Node) bool {
+		if !n.Closed() {
+			return true
+		}
+		path := n.Path()
+		for i, name := range path {
+			path[i] = frameEscaper.Replace(name)
+		}
+		rv[strings.Join(path, Separator)] += n.SelfTime().Microseconds()
+		return true
+	})
+	return rv
+}
+
+func sortedStacks(folded map[string]int64) []string {
+	stacks := make([]string, 0, len(folded))
+	for stack := range folded {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// WriteFolded writes records in Brendan Gregg's folded stack format,
+// weighted by self time in microseconds.
+func WriteFolded(w io.Writer, recs []*sectiontrace.Record) error {
+	return WriteFoldedTree(w, tree.Build(recs))
+}
+
+func WriteFoldedTree(w io.Writer, t *tree.Tree) error {
+	folded := Fold(t)
+	bw := bufio.NewWriter(w)
+	for _, stack := range sortedStacks(folded) {
+		fmt.Fprintf(bw, "%s %d\n", stack, folded[stack])
+	}
+	return bw.Flush()
+}
+
+type speedscopeFrame struct {
+	Name string `json:"name"`
+}
+
+type speedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+type speedscopeFile struct {
+	Schema string `json:"$schema"`
+	Shared struct {
+		Frames []speedscopeFrame `json:"frames"`
+	} `json:"shared"`
+	Profiles []speedscopeProfile `json:"profiles"`
+	Name     string              `json:"name"`
+	Exporter string              `json:"exporter"`
+}
+
+// WriteSpeedscope writes records as a speedscope sampled profile, with
+// one weighted sample per distinct stack of section names.
+func WriteSpeedscope(w io.Writer, recs []*sectiontrace.Record, name string) error {
+	return WriteSpeedscopeTree(w, tree.Build(recs), name)
+}
+
+func WriteSpeedscopeTree(w io.Writer, t *tree.Tree, name string) error {
+	folded := Fold(t)
+
+	out := speedscopeFile{
+		Schema:   "https://www.speedscope.app/file-format-schema.json",
+		Name:     name,
+		Exporter: "sectiontrace",
+	}
+	out.Shared.Frames = []speedscopeFrame{}
+
+	frameIDs := map[string]int{}
+	profile := speedscopeProfile{
+		Type:    "sampled",
+		Name:    name,
+		Unit:    "microseconds",
+		Samples: [][]int{},
+		Weights: []int64{},
+	}
+
+	for _, stack := range sortedStacks(folded) {
+		var sample []int
+		for _, frame := range strings.Split(stack, Separator) {
+			id, ok := frameIDs[frame]
+			if !ok {
+				id = len(out.Shared.Frames)
+				frameIDs[frame] = id
+				out.Shared.Frames = append(out.Shared.Frames, speedscopeFrame{Name: frame})
+			}
+			sample = append(sample, id)
+		}
+		profile.Samples = append(profile.Samples, sample)
+		profile.Weights = append(profile.Weights, folded[stack])
+		profile.EndValue += folded[stack]
+	}
+	out.Profiles = []speedscopeProfile{profile}
+
+	return json.NewEncoder(w).Encode(out)
+}
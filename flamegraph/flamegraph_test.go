@@ -0,0 +1,58 @@
+package flamegraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func testRecords() []*sectiontrace.Record {
+	r := func(name string, id int32, phase sectiontrace.Phase, ts int64, parent int32) *sectiontrace.Record {
+		args := map[string]interface{}{}
+		if parent != 0 {
+			args["p"] = parent
+		}
+		return &sectiontrace.Record{Name: name, ID: id, Phase: phase, TimestampMicros: ts, Args: args}
+	}
+	return []*sectiontrace.Record{
+		r("A", 1, sectiontrace.Begin, 0, 0),
+		r("B", 2, sectiontrace.Begin, 10, 1),
+		r("C;x", 3, sectiontrace.Begin, 20, 2),
+		r("C;x", 3, sectiontrace.End, 30, 2),
+		r("B", 2, sectiontrace.End, 50, 1),
+		r("B", 4, sectiontrace.Begin, 60, 1),
+		r("B", 4, sectiontrace.End, 70, 1),
+		r("A", 1, sectiontrace.End, 100, 0),
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFolded(&buf, testRecords()); err != nil {
+		t.Fatal(err)
+	}
+	want := "A 50\nA;B 40\nA;B;C_x 10\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteSpeedscope(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSpeedscope(&buf, testRecords(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	var got speedscopeFile
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Shared.Frames) != 3 || len(got.Profiles) != 1 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	p := got.Profiles[0]
+	if p.EndValue != 100 || len(p.Samples) != 3 || len(p.Samples[2]) != 3 {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+}
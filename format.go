@@ -1,10 +1,18 @@
 package sectiontrace
 
+import "encoding/json"
+
 type Phase string
 
 const (
-	Begin = Phase("b")
-	End   = Phase("e")
+	Begin   = Phase("b")
+	End     = Phase("e")
+	Instant = Phase("n")
+
+	// Flow events are generated by Export to connect sections to the
+	// sections they follow from or link to.
+	FlowStart = Phase("s")
+	FlowEnd   = Phase("f")
 )
 
 type Record struct {
@@ -16,6 +24,41 @@ type Record struct {
 	ID              int32                  `json:"id"`
 	ProcessID       int32                  `json:"pid"`
 	Args            map[string]interface{} `json:"args,omitempty"`
+
+	// For records made by this package, typed holds the args set while
+	// recording, and Args only those added afterwards, which take
+	// precedence. Use Arg or AllArgs to read them all.
+	typed typedArgs
+}
+
+// Arg returns the value of an arg, whether it is kept in Args or, for
+// records made by this package, in typed form.
+func (r *Record) Arg(key string) (interface{}, bool) {
+	if v, ok := r.Args[key]; ok {
+		return v, true
+	}
+	return r.typed.arg(key)
+}
+
+// AllArgs returns a new map of all of the record's args, or nil if it
+// has none.
+func (r *Record) AllArgs() map[string]interface{} {
+	if len(r.Args) == 0 && r.typed.empty() {
+		return nil
+	}
+	rv := make(map[string]interface{}, len(r.Args))
+	r.typed.setArgs(rv)
+	for k, v := range r.Args {
+		rv[k] = v
+	}
+	return rv
+}
+
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plain Record
+	p := plain(r)
+	p.Args = r.AllArgs()
+	return json.Marshal(p)
 }
 
 type Summary struct {
@@ -26,7 +69,7 @@ type Summary struct {
 
 func Export(recs []*Record) *Summary {
 	rv := &Summary{
-		TraceEvents:     recs,
+		TraceEvents:     withFlows(recs),
 		DisplayTimeUnit: DefaultDisplayTimeUnit,
 	}
 	if len(DefaultOtherData) > 0 {
@@ -34,3 +77,120 @@ func Export(recs []*Record) *Summary {
 	}
 	return rv
 }
+
+// IntArg returns an integer-valued arg such as ArgParent. It accepts the
+// numeric types produced both by this package and by decoding JSON.
+func (r *Record) IntArg(key string) (int32, bool) {
+	v, _ := r.Arg(key)
+	switch v := v.(type) {
+	case int32:
+		return v, true
+	case int:
+		return int32(v), true
+	case int64:
+		return int32(v), true
+	case float64:
+		return int32(v), true
+	}
+	return 0, false
+}
+
+// StringArg returns a string-valued arg such as ArgRemoteParentScope.
+func (r *Record) StringArg(key string) (string, bool) {
+	v, _ := r.Arg(key)
+	s, ok := v.(string)
+	return s, ok
+}
+
+// BoolArg returns a boolean-valued arg such as ArgOK.
+func (r *Record) BoolArg(key string) (bool, bool) {
+	v, _ := r.Arg(key)
+	b, ok := v.(bool)
+	return b, ok
+}
+
+// withFlows adds a pair of flow events for each section begun with
+// ArgFollowsFrom, going from the section it follows from (at the latest
+// at that section's end) to its beginning, and likewise for each link
+// to a section in the same scope. Existing flow events are replaced, so
+// that exporting records read back from a trace does not duplicate them.
+//
+// Follows-from flows reuse the ID of the section they lead to. Links
+// may be many per section, so their flows get negative IDs instead,
+// which never clash with section IDs.
+func withFlows(recs []*Record) []*Record {
+	needed := false
+	for _, rec := range recs {
+		_, follows := rec.Arg(ArgFollowsFrom)
+		_, links := rec.Arg(ArgLinks)
+		if rec.Phase == FlowStart || rec.Phase == FlowEnd || ((follows || links) && rec.Phase == Begin) {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return recs
+	}
+
+	type key struct {
+		scope string
+		id    int32
+	}
+	begun := map[key]bool{}
+	ends := map[key]int64{}
+	for _, rec := range recs {
+		switch rec.Phase {
+		case Begin:
+			begun[key{rec.Scope, rec.ID}] = true
+		case End:
+			ends[key{rec.Scope, rec.ID}] = rec.TimestampMicros
+		}
+	}
+
+	var nextLinkID int32
+	rv := make([]*Record, 0, len(recs))
+	for _, rec := range recs {
+		if rec.Phase == FlowStart || rec.Phase == FlowEnd {
+			continue
+		}
+		rv = append(rv, rec)
+		if rec.Phase != Begin {
+			continue
+		}
+		flow := func(origin int32, id int32, args map[string]interface{}) {
+			start := rec.TimestampMicros
+			if end, ok := ends[key{rec.Scope, origin}]; ok && end < start {
+				start = end
+			}
+			record := func(phase Phase, ts int64) *Record {
+				return &Record{
+					Category:        rec.Category,
+					Name:            rec.Name,
+					Phase:           phase,
+					Scope:           rec.Scope,
+					TimestampMicros: ts,
+					ID:              id,
+					ProcessID:       rec.ProcessID,
+					Args:            args,
+				}
+			}
+			rv = append(rv, record(FlowStart, start), record(FlowEnd, rec.TimestampMicros))
+		}
+		if origin, ok := rec.IntArg(ArgFollowsFrom); ok {
+			flow(origin, rec.ID, map[string]interface{}{ArgFollowsFrom: origin})
+		}
+		for _, link := range rec.Links() {
+			if link.Section.Scope != rec.Scope || !begun[key{rec.Scope, link.Section.ID}] {
+				continue
+			}
+			nextLinkID--
+			args := map[string]interface{}{}
+			for k, v := range link.Attributes {
+				args[k] = v
+			}
+			args[ArgLinks] = link.Section.ID
+			flow(link.Section.ID, nextLinkID, args)
+		}
+	}
+	return rv
+}
@@ -0,0 +1,107 @@
+package sectiontrace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ArgSpawnWait is the time, in microseconds, between a goroutine being
+// spawned by Go or Group.Go and its section beginning. ArgOutlivedParent
+// is set to true if the spawning section ended before the goroutine's.
+// Both are set on the end record.
+const ArgSpawnWait = "sw"
+const ArgOutlivedParent = "op"
+
+func (a *activeSection) closed() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.wasClosed
+}
+
+// setExtraArg adds an arg to the end record, unless the section has
+// already ended.
+func (a *activeSection) setExtraArg(key string, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.wasClosed {
+		return
+	}
+	if a.extraArgs == nil {
+		a.extraArgs = map[string]interface{}{}
+	}
+	a.extraArgs[key] = value
+}
+
+func runSpawned(ctx context.Context, section Section, spawned time.Time, fn func(context.Context) error) error {
+	ctx, sec := section.Begin(ctx)
+	a, recorded := sec.(*activeSection)
+	if recorded {
+		a.setExtraArg(ArgSpawnWait, a.t0.Sub(spawned).Microseconds())
+	}
+
+	err := fn(ctx)
+
+	if recorded && a.state.current != nil && a.state.current.closed() {
+		a.setExtraArg(ArgOutlivedParent, true)
+	}
+	sec.End(err)
+	return err
+}
+
+// Go runs fn in a new goroutine, within a section begun from ctx.
+func Go(ctx context.Context, section Section, fn func(context.Context) error) {
+	spawned := getTimeNow()
+	go runSpawned(ctx, section, spawned, fn)
+}
+
+// Group runs goroutines within sections, like errgroup.Group: the
+// context is cancelled when a goroutine first fails, and Wait returns
+// that goroutine's error. Like errgroup.Group, the zero value is usable,
+// but has no context to cancel, so its goroutines' sections are roots.
+type Group struct {
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// NewGroup returns a Group whose goroutines' sections are children of
+// the section ctx belongs to, along with the context they use.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel}, ctx
+}
+
+func (g *Group) Go(section Section, fn func(context.Context) error) {
+	spawned := getTimeNow()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		ctx := g.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := runSpawned(ctx, section, spawned, fn); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+	}()
+}
+
+// Wait waits for all goroutines started with Go, and returns the first
+// error, if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return g.err
+}
@@ -0,0 +1,119 @@
+package sectiontrace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncCollector struct {
+	mu   sync.Mutex
+	ends map[string]*Record
+
+	// ended, if set, receives the name of each section as it ends.
+	ended chan string
+}
+
+func (c *syncCollector) onBegin(*Record) {}
+
+func (c *syncCollector) onEnd(_, end *Record) {
+	c.mu.Lock()
+	c.ends[end.Name] = end
+	c.mu.Unlock()
+	if c.ended != nil {
+		c.ended <- end.Name
+	}
+}
+
+func TestGo(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	nextNodeID = 0
+	c := &syncCollector{ends: map[string]*Record{}, ended: make(chan string, 2)}
+
+	withHooks(c.onBegin, c.onEnd, func() {
+		release := make(chan struct{})
+
+		ctx, parent := New("spawner").Begin(context.Background())
+		Go(ctx, New("background"), func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+		parent.End(nil)
+		close(release)
+
+		// The goroutine's section ends after fn returns.
+		for name := range c.ended {
+			if name == "background" {
+				break
+			}
+		}
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.ends["background"]
+	if end == nil {
+		t.Fatalf("background section never ended")
+	}
+	if end.AllArgs()[ArgParent] != int32(1) || end.AllArgs()[ArgOutlivedParent] != true {
+		t.Errorf("args = %v", end.AllArgs())
+	}
+	if _, ok := end.AllArgs()[ArgSpawnWait]; !ok {
+		t.Errorf("spawn wait missing: %v", end.AllArgs())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	nextNodeID = 0
+	c := &syncCollector{ends: map[string]*Record{}}
+
+	var err error
+	var groupCtx context.Context
+	withHooks(c.onBegin, c.onEnd, func() {
+		err = New("fanout").Do(context.Background(), func(ctx context.Context) error {
+			g, ctx := NewGroup(ctx)
+			groupCtx = ctx
+			g.Go(New("ok"), func(ctx context.Context) error { return nil })
+			g.Go(New("fails"), func(ctx context.Context) error { return fmt.Errorf("failed") })
+			return g.Wait()
+		})
+	})
+
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("err = %v", err)
+	}
+	if groupCtx.Err() == nil {
+		t.Errorf("group context not cancelled")
+	}
+	for _, name := range []string{"ok", "fails"} {
+		end := c.ends[name]
+		if end == nil || end.AllArgs()[ArgParent] != int32(1) || end.AllArgs()[ArgOutlivedParent] != nil {
+			t.Errorf("%s: %+v", name, end)
+		}
+	}
+	if c.ends["fails"].AllArgs()[ArgOK] != false || c.ends["fanout"].AllArgs()[ArgOK] != false {
+		t.Errorf("failure not recorded")
+	}
+}
+
+func TestGroupZeroValue(t *testing.T) {
+	c := &syncCollector{ends: map[string]*Record{}}
+
+	var err error
+	withHooks(c.onBegin, c.onEnd, func() {
+		var g Group
+		g.Go(New("zero.ok"), func(ctx context.Context) error { return nil })
+		g.Go(New("zero.fails"), func(ctx context.Context) error { return fmt.Errorf("failed") })
+		err = g.Wait()
+	})
+
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("err = %v", err)
+	}
+	if end := c.ends["zero.fails"]; end == nil || end.AllArgs()[ArgOK] != false {
+		t.Errorf("failure not recorded: %+v", end)
+	}
+}
@@ -12,3 +12,49 @@ var OnUsageError func(error) = OnPanic
 
 var OnBegin func(begin *Record)
 var OnEnd func(begin, end *Record)
+
+// OnMark receives the instant records created by ActiveSection.Mark,
+// along with the begin record of the section they were made in.
+var OnMark func(section, mark *Record)
+
+// Sink is a consumer of records, such as an exporter or aggregator.
+type Sink interface {
+	OnBegin(begin *Record)
+	OnEnd(begin, end *Record)
+}
+
+// MarkSink is implemented by sinks that also want instant records.
+type MarkSink interface {
+	OnMark(section, mark *Record)
+}
+
+// InstallSinks sets OnBegin and OnEnd to pass records to each of the
+// given sinks in turn, and OnMark to pass instant records to those that
+// implement MarkSink.
+func InstallSinks(sinks ...Sink) {
+	var markSinks []MarkSink
+	for _, sink := range sinks {
+		if m, ok := sink.(MarkSink); ok {
+			markSinks = append(markSinks, m)
+		}
+	}
+	OnMark = nil
+	if len(markSinks) > 0 {
+		OnMark = func(section, mark *Record) {
+			for _, sink := range markSinks {
+				sink.OnMark(section, mark)
+			}
+		}
+	}
+
+	OnBegin = func(begin *Record) {
+		for _, sink := range sinks {
+			sink.OnBegin(begin)
+		}
+	}
+	OnEnd = func(begin, end *Record) {
+		for _, sink := range sinks {
+			sink.OnEnd(begin, end)
+		}
+	}
+}
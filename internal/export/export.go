@@ -0,0 +1,203 @@
+// Package export holds the batching and delivery logic shared by the
+// exporters that send spans over HTTP.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for the exporters' configuration, used by their constructors
+// and in place of fields left as zero.
+const (
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+	DefaultMaxQueue      = 8192
+	DefaultMaxRetries    = 5
+	DefaultRetryBackoff  = 100 * time.Millisecond
+)
+
+// Batcher queues items and hands them to Send in batches, either when
+// BatchSize items are queued or every FlushInterval. Zero values of the
+// configuration fields are replaced by the defaults.
+type Batcher[T any] struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxQueue      int
+	Send          func(context.Context, []T) error
+	OnError       func(error)
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	queue   []T
+	dropped int64
+
+	sendMu sync.Mutex
+}
+
+func (b *Batcher[T]) start() {
+	b.startOnce.Do(func() {
+		if b.BatchSize <= 0 {
+			b.BatchSize = DefaultBatchSize
+		}
+		if b.FlushInterval <= 0 {
+			b.FlushInterval = DefaultFlushInterval
+		}
+		if b.MaxQueue <= 0 {
+			b.MaxQueue = DefaultMaxQueue
+		}
+		b.wake = make(chan struct{}, 1)
+		b.stop = make(chan struct{})
+		b.done = make(chan struct{})
+		go b.loop()
+	})
+}
+
+func (b *Batcher[T]) loop() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+		if err := b.Flush(context.Background()); err != nil && b.OnError != nil {
+			b.OnError(err)
+		}
+	}
+}
+
+func (b *Batcher[T]) Add(item T) {
+	b.start()
+
+	b.mu.Lock()
+	if len(b.queue) >= b.MaxQueue {
+		b.dropped++
+		b.mu.Unlock()
+		return
+	}
+	b.queue = append(b.queue, item)
+	full := len(b.queue) >= b.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *Batcher[T]) Dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Flush sends all queued items.
+func (b *Batcher[T]) Flush(ctx context.Context) error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	for {
+		b.mu.Lock()
+		n := len(b.queue)
+		if n > b.BatchSize {
+			n = b.BatchSize
+		}
+		batch := b.queue[:n:n]
+		b.queue = b.queue[n:]
+		b.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := b.Send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Shutdown stops the background sender and flushes the queue.
+func (b *Batcher[T]) Shutdown(ctx context.Context) error {
+	b.start()
+	b.stopOnce.Do(func() { close(b.stop) })
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.Flush(ctx)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Retry calls fn until it succeeds, returns a non-retryable error, or
+// has been retried maxRetries times, doubling the backoff each time.
+func Retry(ctx context.Context, maxRetries int, backoff time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if p, permanent := err.(permanentError); permanent {
+			return fmt.Errorf("Failed after %d attempts: %v", attempt+1, p.err)
+		}
+		if attempt >= maxRetries {
+			return fmt.Errorf("Failed after %d attempts: %v", attempt+1, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Post sends a request body. Network errors, 429 and 5xx responses are
+// retryable; other failures are not.
+func Post(ctx context.Context, client *http.Client, url, contentType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("Endpoint %s returned %s", url, resp.Status)
+	}
+	return permanentError{fmt.Errorf("Endpoint %s returned %s", url, resp.Status)}
+}
@@ -0,0 +1,130 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// Format is what sets the exporters apart: how sections are converted
+// into spans, and how batches of spans are sent. Formats are empty
+// structs, so that an exporter's type is determined by its format.
+type Format[T any] interface {
+	DefaultEndpoint() string
+	ContentType() string
+	Convert(begin, end *sectiontrace.Record, serviceName string) T
+	Encode(serviceName string, batch []T) ([]byte, error)
+}
+
+// Exporter is a sectiontrace.Sink that sends completed sections as
+// spans in batches, either when BatchSize spans are queued or every
+// FlushInterval. Failed requests are retried with exponential backoff.
+// Fields left as zero are replaced by the defaults once the exporter
+// receives its first section, and must not be changed afterwards.
+type Exporter[T any, F Format[T]] struct {
+	Endpoint      string
+	ServiceName   string
+	Client        *http.Client
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxQueue bounds the number of queued spans; further spans are
+	// dropped until the queue drains.
+	MaxQueue int
+	// MaxRetries is the number of times a failed request is retried. A
+	// negative value disables retries.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// OnError is called with errors from sending batches in the
+	// background. It may be nil.
+	OnError func(error)
+
+	initOnce sync.Once
+	format   F
+	batcher  *Batcher[T]
+}
+
+// NewExporter returns an exporter with the defaults filled in.
+func NewExporter[T any, F Format[T]](endpoint string) *Exporter[T, F] {
+	return &Exporter[T, F]{
+		Endpoint:      endpoint,
+		ServiceName:   sectiontrace.ProcessName,
+		Client:        http.DefaultClient,
+		BatchSize:     DefaultBatchSize,
+		FlushInterval: DefaultFlushInterval,
+		MaxQueue:      DefaultMaxQueue,
+		MaxRetries:    DefaultMaxRetries,
+		RetryBackoff:  DefaultRetryBackoff,
+	}
+}
+
+// init starts the exporter. The batching defaults are applied by the
+// Batcher.
+func (e *Exporter[T, F]) init() {
+	e.initOnce.Do(func() {
+		if e.Endpoint == "" {
+			e.Endpoint = e.format.DefaultEndpoint()
+		}
+		if e.ServiceName == "" {
+			e.ServiceName = sectiontrace.ProcessName
+		}
+		if e.Client == nil {
+			e.Client = http.DefaultClient
+		}
+		if e.MaxRetries == 0 {
+			e.MaxRetries = DefaultMaxRetries
+		}
+		if e.RetryBackoff <= 0 {
+			e.RetryBackoff = DefaultRetryBackoff
+		}
+		e.batcher = &Batcher[T]{
+			BatchSize:     e.BatchSize,
+			FlushInterval: e.FlushInterval,
+			MaxQueue:      e.MaxQueue,
+			Send:          e.send,
+			OnError:       e.OnError,
+		}
+	})
+}
+
+func (e *Exporter[T, F]) OnBegin(begin *sectiontrace.Record) {}
+
+func (e *Exporter[T, F]) OnEnd(begin, end *sectiontrace.Record) {
+	e.init()
+	e.batcher.Add(e.format.Convert(begin, end, e.ServiceName))
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (e *Exporter[T, F]) Dropped() int64 {
+	e.init()
+	return e.batcher.Dropped()
+}
+
+// Flush sends all queued spans.
+func (e *Exporter[T, F]) Flush(ctx context.Context) error {
+	e.init()
+	return e.batcher.Flush(ctx)
+}
+
+// Shutdown stops the background sender and flushes the queue.
+func (e *Exporter[T, F]) Shutdown(ctx context.Context) error {
+	e.init()
+	return e.batcher.Shutdown(ctx)
+}
+
+func (e *Exporter[T, F]) send(ctx context.Context, batch []T) error {
+	body, err := e.format.Encode(e.ServiceName, batch)
+	if err != nil {
+		return err
+	}
+	err = Retry(ctx, e.MaxRetries, e.RetryBackoff, func() error {
+		return Post(ctx, e.Client, e.Endpoint, e.format.ContentType(), body)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to export %d spans: %v", len(batch), err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package protowire is a minimal protocol buffer encoder, sufficient for
+// writing the handful of well-known formats the exporters produce
+// without depending on a protobuf library.
+package protowire
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type Buffer struct {
+	buf []byte
+}
+
+func (b *Buffer) Bytes() []byte {
+	return b.buf
+}
+
+func (b *Buffer) Len() int {
+	return len(b.buf)
+}
+
+func (b *Buffer) Reset() {
+	b.buf = b.buf[:0]
+}
+
+func (b *Buffer) tag(field, wireType int) {
+	b.buf = binary.AppendUvarint(b.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (b *Buffer) Uint64(field int, v uint64) {
+	b.tag(field, wireVarint)
+	b.buf = binary.AppendUvarint(b.buf, v)
+}
+
+func (b *Buffer) Int64(field int, v int64) {
+	b.Uint64(field, uint64(v))
+}
+
+func (b *Buffer) Int32(field int, v int32) {
+	b.Uint64(field, uint64(int64(v)))
+}
+
+func (b *Buffer) Bool(field int, v bool) {
+	if v {
+		b.Uint64(field, 1)
+	} else {
+		b.Uint64(field, 0)
+	}
+}
+
+func (b *Buffer) Fixed64(field int, v uint64) {
+	b.tag(field, wireFixed64)
+	b.buf = binary.LittleEndian.AppendUint64(b.buf, v)
+}
+
+func (b *Buffer) Double(field int, v float64) {
+	b.Fixed64(field, math.Float64bits(v))
+}
+
+func (b *Buffer) RawBytes(field int, v []byte) {
+	b.tag(field, wireBytes)
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *Buffer) String(field int, v string) {
+	b.tag(field, wireBytes)
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+// Message appends a length-delimited submessage built by fn.
+func (b *Buffer) Message(field int, fn func(*Buffer)) {
+	var sub Buffer
+	fn(&sub)
+	b.RawBytes(field, sub.buf)
+}
+
+func (b *Buffer) PackedUint64s(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, v)
+	}
+	b.RawBytes(field, packed)
+}
+
+func (b *Buffer) PackedInt64s(field int, vs []int64) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	b.RawBytes(field, packed)
+}
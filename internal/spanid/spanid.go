@@ -0,0 +1,115 @@
+// Package spanid derives the fixed-size trace and span IDs used by
+// distributed tracing systems from sectiontrace's scoped node IDs.
+package spanid
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func hash(scope string, id int32) [sha256.Size]byte {
+	buf := make([]byte, 0, len(scope)+5)
+	buf = append(buf, scope...)
+	buf = append(buf, 0)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(id))
+	return sha256.Sum256(buf)
+}
+
+// Span returns the span ID of the section with the given scope and ID.
+func Span(scope string, id int32) SpanID {
+	var rv SpanID
+	h := hash(scope, id)
+	copy(rv[:], h[:])
+	if rv == (SpanID{}) {
+		rv[7] = 1
+	}
+	return rv
+}
+
+// Root returns the scope and ID of the outermost known ancestor of a
+// section, following remote ancestor links across processes.
+func Root(rec *sectiontrace.Record) (string, int32) {
+	if id, ok := rec.IntArg(sectiontrace.ArgRemoteAncestor); ok {
+		scope, _ := rec.StringArg(sectiontrace.ArgRemoteAncestorScope)
+		return scope, id
+	}
+	if id, ok := rec.IntArg(sectiontrace.ArgAncestor); ok {
+		return rec.Scope, id
+	}
+	return rec.Scope, rec.ID
+}
+
+// Trace returns the trace ID of a section. All sections with the same
+// root ancestor share a trace ID.
+func Trace(rec *sectiontrace.Record) TraceID {
+	return traceOf(Root(rec))
+}
+
+func traceOf(scope string, id int32) TraceID {
+	var rv TraceID
+	h := hash(scope, id)
+	copy(rv[:], h[8:])
+	if rv == (TraceID{}) {
+		rv[15] = 1
+	}
+	return rv
+}
+
+// Parent returns the span ID of the section's parent, which may be a
+// remote parent.
+func Parent(rec *sectiontrace.Record) (SpanID, bool) {
+	if id, ok := rec.IntArg(sectiontrace.ArgParent); ok {
+		return Span(rec.Scope, id), true
+	}
+	if id, ok := rec.IntArg(sectiontrace.ArgRemoteParent); ok {
+		scope, _ := rec.StringArg(sectiontrace.ArgRemoteParentScope)
+		return Span(scope, id), true
+	}
+	return SpanID{}, false
+}
+
+// Link returns the trace and span IDs of a linked section. If the link
+// does not say which trace the section belongs to, the section is
+// assumed to be a root.
+func Link(link sectiontrace.Link) (TraceID, SpanID) {
+	root := link.Root
+	if root.ID == 0 {
+		root = link.Section
+	}
+	return traceOf(root.Scope, root.ID), Span(link.Section.Scope, link.Section.ID)
+}
+
+// Links returns the sections a section links to: the one it follows
+// from, if it was detached, which is in the same trace, and those in
+// its ArgLinks arg.
+func Links(rec *sectiontrace.Record) []sectiontrace.Link {
+	links := rec.Links()
+	origin, ok := rec.IntArg(sectiontrace.ArgFollowsFrom)
+	if !ok {
+		return links
+	}
+	scope, id := Root(rec)
+	follows := sectiontrace.Link{
+		Section: sectiontrace.NodeAndScope{Scope: rec.Scope, ID: origin},
+		Root:    sectiontrace.NodeAndScope{Scope: scope, ID: id},
+	}
+	return append([]sectiontrace.Link{follows}, links...)
+}
+
+// IsLinkArg reports whether an arg key is one of the library's own
+// linkage args, which exporters translate rather than copy.
+func IsLinkArg(key string) bool {
+	switch key {
+	case sectiontrace.ArgParent, sectiontrace.ArgAncestor,
+		sectiontrace.ArgRemoteParent, sectiontrace.ArgRemoteParentScope,
+		sectiontrace.ArgRemoteAncestor, sectiontrace.ArgRemoteAncestorScope,
+		sectiontrace.ArgOK, sectiontrace.ArgFollowsFrom, sectiontrace.ArgLinks:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package jaeger
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/spanid"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// The JSON trace format used by the Jaeger UI and query API, which the
+// UI can also load from a file.
+
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type Reference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type Span struct {
+	TraceID       string        `json:"traceID"`
+	SpanID        string        `json:"spanID"`
+	OperationName string        `json:"operationName"`
+	References    []Reference   `json:"references"`
+	StartTime     int64         `json:"startTime"`
+	Duration      int64         `json:"duration"`
+	Tags          []KeyValue    `json:"tags"`
+	Logs          []interface{} `json:"logs"`
+	ProcessID     string        `json:"processID"`
+}
+
+type Process struct {
+	ServiceName string     `json:"serviceName"`
+	Tags        []KeyValue `json:"tags"`
+}
+
+type Trace struct {
+	TraceID   string              `json:"traceID"`
+	Spans     []*Span             `json:"spans"`
+	Processes map[string]*Process `json:"processes"`
+}
+
+type File struct {
+	Data []*Trace `json:"data"`
+}
+
+func toKeyValue(key string, v interface{}) KeyValue {
+	switch v := v.(type) {
+	case string:
+		return KeyValue{Key: key, Type: "string", Value: v}
+	case bool:
+		return KeyValue{Key: key, Type: "bool", Value: v}
+	case int, int32, int64:
+		return KeyValue{Key: key, Type: "int64", Value: v}
+	case float64:
+		return KeyValue{Key: key, Type: "float64", Value: v}
+	}
+	return KeyValue{Key: key, Type: "string", Value: fmt.Sprint(v)}
+}
+
+func processID(pid int32) string {
+	return fmt.Sprintf("p%d", pid)
+}
+
+// Convert turns a completed section into a Jaeger span. Sections that
+// were started from a RemoteInfo reference their remote parent, and
+// linked sections, including the one a detached section follows from,
+// are FOLLOWS_FROM references.
+func Convert(begin, end *sectiontrace.Record) *Span {
+	traceID := spanid.Trace(begin)
+	id := spanid.Span(begin.Scope, begin.ID)
+	traceHex := hex.EncodeToString(traceID[:])
+
+	s := &Span{
+		TraceID:       traceHex,
+		SpanID:        hex.EncodeToString(id[:]),
+		OperationName: begin.Name,
+		References:    []Reference{},
+		StartTime:     begin.TimestampMicros,
+		Duration:      end.TimestampMicros - begin.TimestampMicros,
+		Logs:          []interface{}{},
+		ProcessID:     processID(begin.ProcessID),
+		Tags: []KeyValue{
+			toKeyValue("sectiontrace.scope", begin.Scope),
+			toKeyValue("sectiontrace.id", begin.ID),
+		},
+	}
+	if parent, ok := spanid.Parent(begin); ok {
+		s.References = append(s.References, Reference{
+			RefType: "CHILD_OF",
+			TraceID: traceHex,
+			SpanID:  hex.EncodeToString(parent[:]),
+		})
+	}
+	for _, link := range spanid.Links(begin) {
+		linkTrace, linkSpan := spanid.Link(link)
+		s.References = append(s.References, Reference{
+			RefType: "FOLLOWS_FROM",
+			TraceID: hex.EncodeToString(linkTrace[:]),
+			SpanID:  hex.EncodeToString(linkSpan[:]),
+		})
+	}
+	if ok, _ := end.BoolArg(sectiontrace.ArgOK); !ok {
+		s.Tags = append(s.Tags, toKeyValue("error", true))
+	}
+
+	args := end.AllArgs()
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		if !spanid.IsLinkArg(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.Tags = append(s.Tags, toKeyValue(k, args[k]))
+	}
+	return s
+}
+
+// DefaultMaxTraces is the number of traces kept by a Builder made by
+// NewBuilder.
+var DefaultMaxTraces = 10000
+
+// Builder groups spans into traces. It is safe for concurrent use.
+//
+// Used as a sink, it keeps the spans of the last MaxTraces traces; call
+// Drain to take the ones collected so far.
+type Builder struct {
+	// ServiceName is the service name given to every process.
+	ServiceName string
+	// MaxTraces bounds the number of traces kept; once it is reached,
+	// the oldest trace is dropped to make room for a new one. Zero
+	// means no bound.
+	MaxTraces int
+
+	mu      sync.Mutex
+	traces  map[string]*Trace
+	order   []string
+	evicted int64
+}
+
+func NewBuilder(serviceName string) *Builder {
+	return &Builder{
+		ServiceName: serviceName,
+		MaxTraces:   DefaultMaxTraces,
+		traces:      map[string]*Trace{},
+	}
+}
+
+// Add adds a completed section.
+func (b *Builder) Add(begin, end *sectiontrace.Record) {
+	s := Convert(begin, end)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.traces[s.TraceID]
+	if !ok {
+		if b.MaxTraces > 0 && len(b.order) >= b.MaxTraces {
+			delete(b.traces, b.order[0])
+			b.order = b.order[1:]
+			b.evicted++
+		}
+		t = &Trace{TraceID: s.TraceID, Processes: map[string]*Process{}}
+		b.traces[s.TraceID] = t
+		b.order = append(b.order, s.TraceID)
+	}
+	t.Spans = append(t.Spans, s)
+	if _, ok := t.Processes[s.ProcessID]; !ok {
+		t.Processes[s.ProcessID] = &Process{
+			ServiceName: b.ServiceName,
+			Tags:        []KeyValue{toKeyValue("pid", begin.ProcessID)},
+		}
+	}
+}
+
+// Evicted returns the number of traces dropped because of MaxTraces.
+func (b *Builder) Evicted() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.evicted
+}
+
+// AddRecords pairs up records and adds the closed sections.
+func (b *Builder) AddRecords(recs []*sectiontrace.Record) {
+	tree.Build(recs).Walk(func(n *tree.Node) bool {
+		if n.Closed() {
+			b.Add(n.Begin, n.End)
+		}
+		return true
+	})
+}
+
+func (b *Builder) OnBegin(begin *sectiontrace.Record) {}
+
+func (b *Builder) OnEnd(begin, end *sectiontrace.Record) {
+	b.Add(begin, end)
+}
+
+// File returns a snapshot of the traces collected so far. It does not
+// change as more spans are added.
+func (b *Builder) File() *File {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.fileLocked()
+}
+
+// Drain returns the traces collected so far, like File, and removes them
+// from the builder.
+func (b *Builder) Drain() *File {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := b.fileLocked()
+	b.traces = map[string]*Trace{}
+	b.order = nil
+	return f
+}
+
+func (b *Builder) fileLocked() *File {
+	f := &File{Data: []*Trace{}}
+	for _, id := range b.order {
+		t := b.traces[id]
+		copied := &Trace{TraceID: t.TraceID, Processes: map[string]*Process{}}
+		for _, s := range t.Spans {
+			span := *s
+			span.References = append([]Reference{}, s.References...)
+			span.Tags = append([]KeyValue{}, s.Tags...)
+			span.Logs = append([]interface{}{}, s.Logs...)
+			copied.Spans = append(copied.Spans, &span)
+		}
+		for k, p := range t.Processes {
+			process := *p
+			process.Tags = append([]KeyValue{}, p.Tags...)
+			copied.Processes[k] = &process
+		}
+		f.Data = append(f.Data, copied)
+	}
+	return f
+}
+
+func (b *Builder) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(b.File())
+}
+
+// WriteJSON converts records into a Jaeger JSON trace file.
+func WriteJSON(w io.Writer, recs []*sectiontrace.Record, serviceName string) error {
+	b := NewBuilder(serviceName)
+	b.MaxTraces = 0
+	b.AddRecords(recs)
+	return b.WriteJSON(w)
+}
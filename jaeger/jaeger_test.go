@@ -0,0 +1,136 @@
+package jaeger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func TestWriteJSON(t *testing.T) {
+	recs := []*sectiontrace.Record{
+		{Name: "outer", ID: 1, ProcessID: 5, Phase: sectiontrace.Begin, TimestampMicros: 0, Args: map[string]interface{}{}},
+		{Name: "inner", ID: 2, ProcessID: 5, Phase: sectiontrace.Begin, TimestampMicros: 10, Args: map[string]interface{}{"p": int32(1), "a": int32(1)}},
+		{Name: "inner", ID: 2, ProcessID: 5, Phase: sectiontrace.End, TimestampMicros: 40, Args: map[string]interface{}{"p": int32(1), "a": int32(1), "ok": false}},
+		{Name: "outer", ID: 1, ProcessID: 5, Phase: sectiontrace.End, TimestampMicros: 100, Args: map[string]interface{}{"ok": true}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, recs, "svc"); err != nil {
+		t.Fatal(err)
+	}
+	var f File
+	if err := json.Unmarshal(buf.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Data) != 1 || len(f.Data[0].Spans) != 2 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+	outer, inner := f.Data[0].Spans[0], f.Data[0].Spans[1]
+	if len(inner.References) != 1 || inner.References[0].SpanID != outer.SpanID {
+		t.Errorf("bad references: %+v", inner.References)
+	}
+	if f.Data[0].Processes["p5"].ServiceName != "svc" {
+		t.Errorf("bad processes: %+v", f.Data[0].Processes)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	link := sectiontrace.Link{
+		Section: sectiontrace.NodeAndScope{Scope: "other", ID: 3},
+		Root:    sectiontrace.NodeAndScope{Scope: "other", ID: 1},
+	}
+	begin := &sectiontrace.Record{Name: "batch", Scope: "s", ID: 1, Phase: sectiontrace.Begin, Args: map[string]interface{}{"l": []sectiontrace.Link{link}}}
+	end := &sectiontrace.Record{Name: "batch", Scope: "s", ID: 1, Phase: sectiontrace.End, TimestampMicros: 10, Args: map[string]interface{}{"l": []sectiontrace.Link{link}, "ok": true}}
+
+	b := NewBuilder("svc")
+	b.Add(begin, end)
+	b.Add(
+		&sectiontrace.Record{Name: "input", Scope: "other", ID: 3, Phase: sectiontrace.Begin, Args: map[string]interface{}{"p": int32(1), "a": int32(1)}},
+		&sectiontrace.Record{Name: "input", Scope: "other", ID: 3, Phase: sectiontrace.End, Args: map[string]interface{}{"p": int32(1), "a": int32(1), "ok": true}},
+	)
+
+	f := b.File()
+	if len(f.Data) != 2 {
+		t.Fatalf("got %d traces", len(f.Data))
+	}
+	batch, input := f.Data[0].Spans[0], f.Data[1].Spans[0]
+	if len(batch.References) != 1 {
+		t.Fatalf("bad references: %+v", batch.References)
+	}
+	ref := batch.References[0]
+	if ref.RefType != "FOLLOWS_FROM" || ref.SpanID != input.SpanID || ref.TraceID != input.TraceID {
+		t.Errorf("bad reference %+v to %+v", ref, input)
+	}
+	for _, tag := range batch.Tags {
+		if tag.Key == "l" {
+			t.Errorf("links copied to tags")
+		}
+	}
+}
+
+func TestFollowsFrom(t *testing.T) {
+	args := map[string]interface{}{"f": int32(2), "a": int32(1)}
+	begin := &sectiontrace.Record{Name: "refresh", Scope: "s", ID: 3, Phase: sectiontrace.Begin, Args: args}
+	end := &sectiontrace.Record{Name: "refresh", Scope: "s", ID: 3, Phase: sectiontrace.End, Args: map[string]interface{}{"f": int32(2), "a": int32(1), "ok": true}}
+	origin := &sectiontrace.Record{Name: "request", Scope: "s", ID: 2, Phase: sectiontrace.Begin, Args: map[string]interface{}{"p": int32(1), "a": int32(1)}}
+
+	s := Convert(begin, end)
+	o := Convert(origin, origin)
+	if s.TraceID != o.TraceID {
+		t.Errorf("detached section in another trace")
+	}
+	if len(s.References) != 1 || s.References[0].RefType != "FOLLOWS_FROM" || s.References[0].SpanID != o.SpanID {
+		t.Errorf("bad references: %+v", s.References)
+	}
+	for _, tag := range s.Tags {
+		if tag.Key == "f" {
+			t.Errorf("follows-from copied to tags")
+		}
+	}
+}
+
+func TestFileSnapshot(t *testing.T) {
+	b := NewBuilder("svc")
+	add := func(id int32) {
+		b.Add(
+			&sectiontrace.Record{Name: "root", ID: id, Phase: sectiontrace.Begin, Args: map[string]interface{}{}},
+			&sectiontrace.Record{Name: "root", ID: id, Phase: sectiontrace.End, Args: map[string]interface{}{"ok": true}},
+		)
+	}
+	add(1)
+	f := b.File()
+	f.Data[0].Spans[0].OperationName = "changed"
+
+	add(1)
+	if len(f.Data[0].Spans) != 1 {
+		t.Errorf("snapshot changed by Add: %d spans", len(f.Data[0].Spans))
+	}
+	if got := b.File().Data[0].Spans[0].OperationName; got != "root" {
+		t.Errorf("builder changed through snapshot: %q", got)
+	}
+}
+
+func TestBuilderBounded(t *testing.T) {
+	b := NewBuilder("svc")
+	b.MaxTraces = 2
+	for id := int32(1); id <= 3; id++ {
+		b.OnEnd(
+			&sectiontrace.Record{Name: "root", ID: id, Phase: sectiontrace.Begin, Args: map[string]interface{}{}},
+			&sectiontrace.Record{Name: "root", ID: id, Phase: sectiontrace.End, Args: map[string]interface{}{"ok": true}},
+		)
+	}
+
+	f := b.Drain()
+	if len(f.Data) != 2 || b.Evicted() != 1 {
+		t.Fatalf("kept %d traces, evicted %d", len(f.Data), b.Evicted())
+	}
+	if id := fmt.Sprint(f.Data[0].Spans[0].Tags[1].Value); id != "2" {
+		t.Errorf("first trace kept is #%s, want #2", id)
+	}
+	if got := len(b.File().Data); got != 0 {
+		t.Errorf("%d traces left after Drain", got)
+	}
+}
@@ -0,0 +1,101 @@
+package sectiontrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ArgLinks is set on sections begun from a context returned by
+// WithLinks, to the list of links.
+const ArgLinks = "l"
+
+// Link refers to a section that a section depends on without being
+// nested in it, such as one of the inputs of a batch.
+type Link struct {
+	Section NodeAndScope `json:"section"`
+
+	// Root is the outermost ancestor of the linked section, which
+	// identifies its trace. It may be left empty if it is not known.
+	Root NodeAndScope `json:"root"`
+
+	Attributes map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// validate checks that a link has a target. The scope may be empty,
+// since that is the default scope of local sections.
+func (l Link) validate() error {
+	if l.Section.ID == 0 {
+		return fmt.Errorf("Invalid link target: %+v", l.Section)
+	}
+	return nil
+}
+
+// Link returns a link to the remote section info refers to. It returns
+// false if info does not refer to a section, e.g. if it was sampled out.
+func (info *RemoteInfo) Link() (Link, bool) {
+	if info.SampledOut || info.Parent.ID == 0 {
+		return Link{}, false
+	}
+	return Link{Section: info.Parent, Root: info.Ancestor}, true
+}
+
+// LinkFromContext returns a link to the innermost section ctx was
+// returned from. It returns false outside of any section, or if the
+// section is not recorded.
+func LinkFromContext(ctx context.Context) (Link, bool) {
+	info := OutgoingRemoteInfo(ctx)
+	if info == nil {
+		return Link{}, false
+	}
+	return info.Link()
+}
+
+// WithLinks returns a context whose sections record links to the given
+// sections, in the ArgLinks arg, in addition to their parent. Only the
+// sections begun directly from the returned context have the links.
+func WithLinks(ctx context.Context, links ...Link) context.Context {
+	state, err := stateFromContext(ctx)
+	if err == nil && state.sampledOut {
+		return ctx
+	}
+
+	combined := make([]Link, 0, len(state.links)+len(links))
+	combined = append(combined, state.links...)
+	for _, link := range links {
+		if err := link.validate(); err != nil {
+			doUsageError(err)
+			continue
+		}
+		combined = append(combined, link)
+	}
+	if len(combined) == len(state.links) {
+		return ctx
+	}
+
+	state.links = combined
+	state.err = err
+	return &stateContext{Context: ctx, state: state}
+}
+
+// Links returns the links recorded in the ArgLinks arg. It accepts both
+// the value set by this package and the result of decoding it from JSON.
+func (r *Record) Links() []Link {
+	v, _ := r.Arg(ArgLinks)
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []Link:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var rv []Link
+		if err := json.Unmarshal(data, &rv); err != nil {
+			return nil
+		}
+		return rv
+	}
+}
@@ -0,0 +1,101 @@
+package sectiontrace
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithLinks(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	nextNodeID = 0
+
+	var inputs []Link
+	for i := 0; i < 2; i++ {
+		_ = New("input").Do(context.Background(), func(ctx context.Context) error {
+			link, ok := LinkFromContext(ctx)
+			if !ok {
+				t.Fatalf("no link within section")
+			}
+			link.Attributes = map[string]interface{}{"index": i}
+			inputs = append(inputs, link)
+			return nil
+		})
+		currentTestTime = currentTestTime.Add(time.Second)
+	}
+	if _, ok := LinkFromContext(context.Background()); ok {
+		t.Errorf("link outside of any section")
+	}
+
+	_ = New("batch").Do(WithLinks(context.Background(), inputs...), func(ctx context.Context) error {
+		return New("step").Do(ctx, func(context.Context) error { return nil })
+	})
+
+	batch, step := collectedRecords[4], collectedRecords[5]
+	if batch.Name != "batch" || !reflect.DeepEqual(batch.Links(), inputs) {
+		t.Fatalf("batch begin record = %+v", batch)
+	}
+	if want := (NodeAndScope{Scope: DefaultScope, ID: 2}); inputs[1].Section != want || inputs[1].Root != want {
+		t.Errorf("link = %+v", inputs[1])
+	}
+	if _, ok := step.AllArgs()[ArgLinks]; ok {
+		t.Errorf("links inherited by child: %v", step.AllArgs())
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Record
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if links := decoded.Links(); len(links) != 2 || links[1].Section.ID != 2 || links[1].Attributes["index"] != 1.0 {
+		t.Errorf("decoded links = %+v", links)
+	}
+
+	var flows []*Record
+	for _, rec := range Export(collectedRecords).TraceEvents {
+		if rec.Phase == FlowStart || rec.Phase == FlowEnd {
+			flows = append(flows, rec)
+		}
+	}
+	if len(flows) != 4 {
+		t.Fatalf("got %d flow events, want 4", len(flows))
+	}
+	if flows[0].ID != flows[1].ID || flows[2].ID != flows[3].ID || flows[0].ID == flows[2].ID || flows[0].ID > 0 {
+		t.Errorf("bad flow IDs: %d %d %d %d", flows[0].ID, flows[1].ID, flows[2].ID, flows[3].ID)
+	}
+	if flows[2].TimestampMicros != 1231000000 || flows[2].AllArgs()["index"] != 1 {
+		t.Errorf("flow start = %+v", flows[2])
+	}
+}
+
+func TestLinksDefaultScope(t *testing.T) {
+	defer func(scope string) { DefaultScope = scope }(DefaultScope)
+	DefaultScope = ""
+	collectedRecords = nil
+	usageErrors = nil
+	nextNodeID = 0
+
+	var link Link
+	_ = New("input").Do(context.Background(), func(ctx context.Context) error {
+		link, _ = LinkFromContext(ctx)
+		return nil
+	})
+	_ = New("batch").Do(WithLinks(context.Background(), link), func(context.Context) error { return nil })
+
+	if len(usageErrors) != 0 {
+		t.Fatalf("usage errors: %v", usageErrors)
+	}
+	if links := collectedRecords[2].Links(); len(links) != 1 || links[0].Section != (NodeAndScope{ID: 1}) {
+		t.Errorf("links = %+v", links)
+	}
+
+	if _, ok := (&RemoteInfo{SampledOut: true}).Link(); ok {
+		t.Errorf("link to a sampled-out remote section")
+	}
+}
@@ -0,0 +1,314 @@
+package merge
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/skew"
+)
+
+// Report describes the adjustments made while merging.
+type Report struct {
+	// Offsets are the clock corrections applied to each input, in order.
+	Offsets []time.Duration
+	// PIDs maps remapped process IDs, per input, from old to new.
+	PIDs []map[int32]int32
+	// Scopes maps renamed scopes, per input, from old to new.
+	Scopes []map[string]string
+	// Links is the number of remote parent links between inputs, and
+	// Unresolved the number of remote parent links that could not be
+	// resolved to a section in any input.
+	Links      int
+	Unresolved int
+	// Skew holds the per-scope clock offset estimates, including
+	// confidence intervals and any inconsistent pairs.
+	Skew *skew.Result
+}
+
+type key struct {
+	scope string
+	id    int32
+}
+
+type span struct {
+	begin, end int64
+}
+
+func copyRecord(rec *sectiontrace.Record) *sectiontrace.Record {
+	rv := *rec
+	rv.Args = make(map[string]interface{}, len(rec.Args))
+	for k, v := range rec.Args {
+		rv.Args[k] = v
+	}
+	return &rv
+}
+
+// Merge combines traces from several processes into one. Each input is
+// assumed to come from a single clock.
+//
+// Process IDs that occur in more than one input are remapped, and so
+// are scopes, with remote references rewritten to point to the input
+// that actually contains the referenced section. Inputs are then shifted
+// in time using the offsets estimated by the skew package, so that
+// sections started from a RemoteInfo lie within their remote parents.
+func Merge(inputs []*sectiontrace.Summary) (*sectiontrace.Summary, *Report) {
+	report := &Report{
+		Offsets: make([]time.Duration, len(inputs)),
+		PIDs:    make([]map[int32]int32, len(inputs)),
+		Scopes:  make([]map[string]string, len(inputs)),
+	}
+
+	recs := make([][]*sectiontrace.Record, len(inputs))
+	for i, input := range inputs {
+		for _, rec := range input.TraceEvents {
+			recs[i] = append(recs[i], copyRecord(rec))
+		}
+	}
+
+	remapPIDs(recs, report)
+
+	// Index sections by their original scope before renaming.
+	spans := make([]map[key]*span, len(inputs))
+	for i := range recs {
+		spans[i] = map[key]*span{}
+		for _, rec := range recs[i] {
+			k := key{rec.Scope, rec.ID}
+			s, ok := spans[i][k]
+			if !ok {
+				s = &span{begin: rec.TimestampMicros, end: rec.TimestampMicros}
+				spans[i][k] = s
+			}
+			switch rec.Phase {
+			case sectiontrace.Begin:
+				s.begin = rec.TimestampMicros
+			case sectiontrace.End:
+				s.end = rec.TimestampMicros
+			}
+		}
+	}
+
+	renameScopes(recs, spans, report)
+
+	offsets := alignClocks(recs, spans, report)
+	for i := range recs {
+		report.Offsets[i] = time.Duration(offsets[i]) * time.Microsecond
+		for _, rec := range recs[i] {
+			rec.TimestampMicros += offsets[i]
+		}
+	}
+
+	var all []*sectiontrace.Record
+	for i := range recs {
+		all = append(all, recs[i]...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].TimestampMicros < all[j].TimestampMicros
+	})
+
+	rv := sectiontrace.Export(all)
+	otherData := map[string]interface{}{}
+	for i := len(inputs) - 1; i >= 0; i-- {
+		if inputs[i].DisplayTimeUnit != "" {
+			rv.DisplayTimeUnit = inputs[i].DisplayTimeUnit
+		}
+		for k, v := range inputs[i].OtherData {
+			otherData[k] = v
+		}
+	}
+	rv.OtherData = nil
+	if len(otherData) > 0 {
+		rv.OtherData = otherData
+	}
+	return rv, report
+}
+
+func remapPIDs(recs [][]*sectiontrace.Record, report *Report) {
+	used := map[int32]bool{}
+	maxPID := int32(0)
+	for i := range recs {
+		for _, rec := range recs[i] {
+			if rec.ProcessID > maxPID {
+				maxPID = rec.ProcessID
+			}
+		}
+	}
+
+	for i := range recs {
+		remap := map[int32]int32{}
+		seen := map[int32]bool{}
+		for _, rec := range recs[i] {
+			if seen[rec.ProcessID] {
+				continue
+			}
+			seen[rec.ProcessID] = true
+			if used[rec.ProcessID] {
+				maxPID++
+				remap[rec.ProcessID] = maxPID
+			}
+		}
+		for pid := range seen {
+			if newPID, ok := remap[pid]; ok {
+				used[newPID] = true
+			} else {
+				used[pid] = true
+			}
+		}
+		for _, rec := range recs[i] {
+			if newPID, ok := remap[rec.ProcessID]; ok {
+				rec.ProcessID = newPID
+			}
+		}
+		if len(remap) > 0 {
+			report.PIDs[i] = remap
+		}
+	}
+}
+
+// renameScopes makes scopes unique across inputs, and rewrites remote
+// references and links to point at the renamed scopes.
+func renameScopes(recs [][]*sectiontrace.Record, spans []map[key]*span, report *Report) {
+	owners := map[string][]int{}
+	for i := range recs {
+		seen := map[string]bool{}
+		for _, rec := range recs[i] {
+			if !seen[rec.Scope] {
+				seen[rec.Scope] = true
+				owners[rec.Scope] = append(owners[rec.Scope], i)
+			}
+		}
+	}
+
+	newScope := func(i int, scope string) string {
+		if owners[scope][0] == i {
+			return scope
+		}
+		return fmt.Sprintf("%s#%d", scope, i)
+	}
+
+	// resolve finds the input that holds a referenced section. Remote
+	// parents are looked for in other inputs first, whereas a link into
+	// the referencing input is taken at face value.
+	resolve := func(from int, scope string, id int32, preferFrom bool) (int, bool) {
+		if _, ok := spans[from][key{scope, id}]; ok && preferFrom {
+			return from, true
+		}
+		candidates := owners[scope]
+		for _, i := range candidates {
+			if _, ok := spans[i][key{scope, id}]; ok && i != from {
+				return i, true
+			}
+		}
+		for _, i := range candidates {
+			if _, ok := spans[i][key{scope, id}]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	for i := range recs {
+		for _, rec := range recs[i] {
+			for _, ref := range [][2]string{
+				{sectiontrace.ArgRemoteParent, sectiontrace.ArgRemoteParentScope},
+				{sectiontrace.ArgRemoteAncestor, sectiontrace.ArgRemoteAncestorScope},
+			} {
+				id, ok := rec.IntArg(ref[0])
+				if !ok {
+					continue
+				}
+				scope, _ := rec.StringArg(ref[1])
+				if owner, ok := resolve(i, scope, id, false); ok {
+					rec.Args[ref[1]] = newScope(owner, scope)
+				}
+			}
+
+			links := rec.Links()
+			if len(links) == 0 {
+				continue
+			}
+			renamed := make([]sectiontrace.Link, len(links))
+			for j, link := range links {
+				for _, ref := range []*sectiontrace.NodeAndScope{&link.Section, &link.Root} {
+					if owner, ok := resolve(i, ref.Scope, ref.ID, true); ok {
+						ref.Scope = newScope(owner, ref.Scope)
+					}
+				}
+				renamed[j] = link
+			}
+			rec.Args[sectiontrace.ArgLinks] = renamed
+		}
+	}
+
+	for i := range recs {
+		for _, rec := range recs[i] {
+			renamed := newScope(i, rec.Scope)
+			if renamed == rec.Scope {
+				continue
+			}
+			if report.Scopes[i] == nil {
+				report.Scopes[i] = map[string]string{}
+			}
+			report.Scopes[i][rec.Scope] = renamed
+			rec.Scope = renamed
+		}
+	}
+
+	// Re-key the spans under the new scope names.
+	for i := range spans {
+		rekeyed := map[key]*span{}
+		for k, s := range spans[i] {
+			rekeyed[key{newScope(i, k.scope), k.id}] = s
+		}
+		spans[i] = rekeyed
+	}
+}
+
+// alignClocks counts the links between inputs, and returns per-input
+// offsets estimated from them.
+func alignClocks(recs [][]*sectiontrace.Record, spans []map[key]*span, report *Report) []int64 {
+	owner := map[key]int{}
+	for i := range spans {
+		for k := range spans[i] {
+			owner[k] = i
+		}
+	}
+
+	var all []*sectiontrace.Record
+	for i := range recs {
+		all = append(all, recs[i]...)
+		for _, rec := range recs[i] {
+			if rec.Phase != sectiontrace.Begin {
+				continue
+			}
+			id, ok := rec.IntArg(sectiontrace.ArgRemoteParent)
+			if !ok {
+				continue
+			}
+			scope, _ := rec.StringArg(sectiontrace.ArgRemoteParentScope)
+			j, ok := owner[key{scope, id}]
+			switch {
+			case !ok:
+				report.Unresolved++
+			case j != i:
+				report.Links++
+			}
+		}
+	}
+
+	report.Skew = skew.Estimate(all)
+
+	// Inputs are assumed to have a single clock, so use the offset of
+	// the first scope in each.
+	offsets := make([]int64, len(recs))
+	for i := range recs {
+		if len(recs[i]) == 0 {
+			continue
+		}
+		if o, ok := report.Skew.Offsets[recs[i][0].Scope]; ok {
+			offsets[i] = o.Offset.Microseconds()
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,86 @@
+package merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+func rec(name, scope string, id int32, phase sectiontrace.Phase, ts int64, pid int32, args map[string]interface{}) *sectiontrace.Record {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return &sectiontrace.Record{Name: name, Scope: scope, ID: id, Phase: phase, TimestampMicros: ts, ProcessID: pid, Args: args}
+}
+
+func TestMerge(t *testing.T) {
+	client := sectiontrace.Export([]*sectiontrace.Record{
+		rec("request", "", 1, sectiontrace.Begin, 1000, 42, nil),
+		rec("call", "", 2, sectiontrace.Begin, 1100, 42, map[string]interface{}{"p": int32(1), "a": int32(1)}),
+		rec("call", "", 2, sectiontrace.End, 1900, 42, map[string]interface{}{"p": int32(1), "a": int32(1), "ok": true}),
+		rec("request", "", 1, sectiontrace.End, 2000, 42, map[string]interface{}{"ok": true}),
+	})
+	// The server uses the same pid and scope, and its clock is 5ms ahead.
+	remote := map[string]interface{}{"rp": int32(2), "rps": "", "ra": int32(1), "ras": ""}
+	server := sectiontrace.Export([]*sectiontrace.Record{
+		rec("serve", "", 1, sectiontrace.Begin, 6200, 42, remote),
+		rec("serve", "", 1, sectiontrace.End, 6800, 42, remote),
+	})
+
+	merged, report := Merge([]*sectiontrace.Summary{client, server})
+
+	if report.Links != 1 || report.Unresolved != 0 {
+		t.Errorf("links = %d, unresolved = %d", report.Links, report.Unresolved)
+	}
+	if got, want := report.Offsets[1], -5*time.Millisecond; got != want {
+		t.Errorf("server offset = %v want %v", got, want)
+	}
+	if report.PIDs[1][42] == 0 || report.Scopes[1][""] == "" {
+		t.Errorf("pid/scope not remapped: %+v %+v", report.PIDs, report.Scopes)
+	}
+
+	tr := tree.FromSummary(merged)
+	if len(tr.Roots) != 1 || len(tr.Orphans) != 0 {
+		t.Fatalf("roots = %d, orphans = %d", len(tr.Roots), len(tr.Orphans))
+	}
+	serve := tr.Lookup(report.Scopes[1][""], 1)
+	if serve == nil || serve.Parent == nil || serve.Parent.Name != "call" {
+		t.Fatalf("remote parent not resolved: %+v", serve)
+	}
+	if serve.Start() < serve.Parent.Start() || serve.Finish() > serve.Parent.Finish() {
+		t.Errorf("server section [%d, %d] not within client call [%d, %d]",
+			serve.Start(), serve.Finish(), serve.Parent.Start(), serve.Parent.Finish())
+	}
+}
+
+func TestMergeLinks(t *testing.T) {
+	local := sectiontrace.Link{Section: sectiontrace.NodeAndScope{ID: 1}, Root: sectiontrace.NodeAndScope{ID: 1}}
+	remote := sectiontrace.Link{Section: sectiontrace.NodeAndScope{ID: 3}, Root: sectiontrace.NodeAndScope{ID: 3}}
+	links := map[string]interface{}{"l": []sectiontrace.Link{local, remote}}
+
+	a := sectiontrace.Export([]*sectiontrace.Record{
+		rec("input", "", 1, sectiontrace.Begin, 1000, 1, nil),
+		rec("input", "", 1, sectiontrace.End, 1100, 1, map[string]interface{}{"ok": true}),
+		rec("other", "", 3, sectiontrace.Begin, 1000, 1, nil),
+		rec("other", "", 3, sectiontrace.End, 1100, 1, map[string]interface{}{"ok": true}),
+	})
+	b := sectiontrace.Export([]*sectiontrace.Record{
+		rec("input", "", 1, sectiontrace.Begin, 1000, 2, nil),
+		rec("input", "", 1, sectiontrace.End, 1100, 2, map[string]interface{}{"ok": true}),
+		rec("batch", "", 2, sectiontrace.Begin, 1200, 2, links),
+		rec("batch", "", 2, sectiontrace.End, 1300, 2, map[string]interface{}{"ok": true}),
+	})
+
+	merged, report := Merge([]*sectiontrace.Summary{a, b})
+
+	tr := tree.FromSummary(merged)
+	batch := tr.Lookup(report.Scopes[1][""], 2)
+	if batch == nil || len(batch.Links) != 2 {
+		t.Fatalf("links not resolved: %+v", batch)
+	}
+	if batch.Links[0] != tr.Lookup(report.Scopes[1][""], 1) || batch.Links[1] != tr.Lookup("", 3) {
+		t.Errorf("links resolved to %+v, %+v", batch.Links[0], batch.Links[1])
+	}
+}
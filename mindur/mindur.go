@@ -0,0 +1,149 @@
+// Package mindur provides a sink that drops short sections, keeping
+// failed sections and the ancestors of every section that is kept.
+package mindur
+
+import (
+	"sync"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// ArgElided is set on the end record of a kept section to the number of
+// its descendants that were dropped.
+const ArgElided = sectiontrace.ArgElided
+
+type key struct {
+	scope string
+	id    int32
+}
+
+type section struct {
+	begin   *sectiontrace.Record
+	parent  *section
+	emitted bool
+	elided  int32
+
+	// end is set when the section was dropped, in case a descendant that
+	// outlives it is kept later on.
+	end *sectiontrace.Record
+}
+
+// Filter is a sectiontrace.Sink that passes on sections lasting at least
+// Threshold, sections that failed, and sections with descendants that
+// are passed on. It is safe for concurrent use.
+//
+// Since whether a section is kept is only known once it ends, begin
+// records are held back until the section or one of its descendants is
+// kept; Next then receives the begin records of all its ancestors first.
+// If an ancestor was already dropped, it is passed on after all, with its
+// end record following the descendant's. Sections that never end are
+// never passed on. Next is called with the filter's lock held, so that
+// records are passed on in order.
+type Filter struct {
+	Next      sectiontrace.Sink
+	Threshold time.Duration
+
+	mu    sync.Mutex
+	open  map[key]*section
+	kept  int64
+	elide int64
+}
+
+func New(next sectiontrace.Sink, threshold time.Duration) *Filter {
+	return &Filter{
+		Next:      next,
+		Threshold: threshold,
+		open:      map[key]*section{},
+	}
+}
+
+// Stats returns the number of sections passed on and dropped.
+func (f *Filter) Stats() (kept, elided int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.kept, f.elide
+}
+
+func (f *Filter) OnBegin(begin *sectiontrace.Record) {
+	s := &section{begin: begin}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if parentID, ok := begin.IntArg(sectiontrace.ArgParent); ok {
+		s.parent = f.open[key{begin.Scope, parentID}]
+	}
+	f.open[key{begin.Scope, begin.ID}] = s
+}
+
+func (f *Filter) OnEnd(begin, end *sectiontrace.Record) {
+	k := key{end.Scope, end.ID}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.open[k]
+	if !ok {
+		// Began before the filter was installed.
+		f.Next.OnEnd(begin, end)
+		return
+	}
+	delete(f.open, k)
+
+	sectionOK, present := end.BoolArg(sectiontrace.ArgOK)
+	failed := present && !sectionOK
+	short := time.Duration(end.TimestampMicros-begin.TimestampMicros)*time.Microsecond < f.Threshold
+
+	if short && !failed && !s.emitted {
+		f.elide++
+		s.end = end
+		if s.parent != nil {
+			s.parent.elided += 1 + s.elided
+		}
+		return
+	}
+	f.kept++
+
+	// Collect the begin records not yet passed on, root first, and the
+	// ancestors that were dropped before this section ended, innermost
+	// first.
+	var begins []*sectiontrace.Record
+	var revived []*section
+	for a := s; a != nil && !a.emitted; a = a.parent {
+		a.emitted = true
+		begins = append([]*sectiontrace.Record{a.begin}, begins...)
+		if a.end != nil {
+			f.elide--
+			f.kept++
+			revived = append(revived, a)
+			if a.parent != nil {
+				a.parent.elided--
+			}
+		}
+	}
+
+	for _, b := range begins {
+		f.Next.OnBegin(b)
+	}
+	f.Next.OnEnd(begin, withElided(end, s.elided))
+	for _, a := range revived {
+		f.Next.OnEnd(a.begin, withElided(a.end, a.elided))
+		a.end = nil
+	}
+}
+
+// withElided returns a copy of end with ArgElided set, if any descendants
+// were dropped.
+func withElided(end *sectiontrace.Record, elided int32) *sectiontrace.Record {
+	if elided <= 0 {
+		return end
+	}
+	copied := *end
+	copied.Args = make(map[string]interface{}, len(end.Args)+1)
+	for k, v := range end.Args {
+		copied.Args[k] = v
+	}
+	copied.Args[ArgElided] = elided
+	return &copied
+}
@@ -0,0 +1,191 @@
+package mindur
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type collector struct {
+	recs []*sectiontrace.Record
+}
+
+func (c *collector) OnBegin(begin *sectiontrace.Record) {
+	c.recs = append(c.recs, begin)
+}
+
+func (c *collector) OnEnd(begin, end *sectiontrace.Record) {
+	c.recs = append(c.recs, end)
+}
+
+func rec(id, parent int32, phase sectiontrace.Phase, ts int64, ok bool) *sectiontrace.Record {
+	args := map[string]interface{}{}
+	if parent != 0 {
+		args["p"] = parent
+	}
+	if phase == sectiontrace.End {
+		args["ok"] = ok
+	}
+	return &sectiontrace.Record{ID: id, Phase: phase, TimestampMicros: ts, Args: args}
+}
+
+func TestFilter(t *testing.T) {
+	out := &collector{}
+	f := New(out, time.Millisecond)
+
+	// root (short, but has a kept descendant)
+	//   a (short, with a short child a1)
+	//   b (short, but has a failed child b1)
+	//   c (long)
+	begins := map[int32]*sectiontrace.Record{}
+	b := func(id, parent int32, ts int64) {
+		begins[id] = rec(id, parent, sectiontrace.Begin, ts, true)
+		f.OnBegin(begins[id])
+	}
+	e := func(id, parent int32, ts int64, ok bool) {
+		f.OnEnd(begins[id], rec(id, parent, sectiontrace.End, ts, ok))
+	}
+	b(1, 0, 0)
+	b(2, 1, 10)
+	b(3, 2, 20)
+	e(3, 2, 30, true)
+	e(2, 1, 40, true)
+	b(4, 1, 50)
+	b(5, 4, 60)
+	e(5, 4, 70, false)
+	e(4, 1, 80, true)
+	b(6, 1, 100)
+	e(6, 1, 1200, true)
+	e(1, 0, 1300, true)
+
+	var got []int32
+	for _, r := range out.recs {
+		if r.Phase == sectiontrace.Begin {
+			got = append(got, r.ID)
+		} else {
+			got = append(got, -r.ID)
+		}
+	}
+	want := []int32{1, 4, 5, -5, -4, 6, -6, -1}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+
+	rootEnd := out.recs[len(out.recs)-1]
+	if n, _ := rootEnd.IntArg(ArgElided); n != 2 {
+		t.Errorf("root elided = %v", rootEnd.Args)
+	}
+	if _, ok := begins[1].Args[ArgElided]; ok {
+		t.Errorf("begin record modified")
+	}
+	if kept, elided := f.Stats(); kept != 4 || elided != 2 {
+		t.Errorf("stats = %d, %d", kept, elided)
+	}
+}
+
+func TestFilterLateDescendant(t *testing.T) {
+	out := &collector{}
+	f := New(out, time.Millisecond)
+
+	// root (long)
+	//   a (short, dropped before its child ends)
+	//     a1 (long)
+	//     a2 (short)
+	begins := map[int32]*sectiontrace.Record{}
+	b := func(id, parent int32, ts int64) {
+		begins[id] = rec(id, parent, sectiontrace.Begin, ts, true)
+		f.OnBegin(begins[id])
+	}
+	e := func(id, parent int32, ts int64) {
+		f.OnEnd(begins[id], rec(id, parent, sectiontrace.End, ts, true))
+	}
+	b(1, 0, 0)
+	b(2, 1, 10)
+	b(3, 2, 20)
+	b(4, 2, 30)
+	e(4, 2, 40)
+	e(2, 1, 50)
+	e(3, 2, 2000)
+	e(1, 0, 3000)
+
+	var got []int32
+	for _, r := range out.recs {
+		if r.Phase == sectiontrace.Begin {
+			got = append(got, r.ID)
+		} else {
+			got = append(got, -r.ID)
+		}
+	}
+	want := []int32{1, 2, 3, -3, -2, -1}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+
+	if n, _ := out.recs[4].IntArg(ArgElided); n != 1 {
+		t.Errorf("a elided = %v", out.recs[4].Args)
+	}
+	if n, _ := out.recs[5].IntArg(ArgElided); n != 1 {
+		t.Errorf("root elided = %v", out.recs[5].Args)
+	}
+	if kept, elided := f.Stats(); kept != 3 || elided != 1 {
+		t.Errorf("stats = %d, %d", kept, elided)
+	}
+}
+
+func TestFilterConcurrentOrder(t *testing.T) {
+	out := &orderChecker{t: t, begun: map[int32]bool{}}
+	f := New(out, 0)
+
+	root := rec(1, 0, sectiontrace.Begin, 0, true)
+	f.OnBegin(root)
+
+	var wg sync.WaitGroup
+	for i := int32(2); i < 50; i++ {
+		begin := rec(i, 1, sectiontrace.Begin, 10, true)
+		f.OnBegin(begin)
+		wg.Add(1)
+		go func(id int32, begin *sectiontrace.Record) {
+			defer wg.Done()
+			f.OnEnd(begin, rec(id, 1, sectiontrace.End, 20, true))
+		}(i, begin)
+	}
+	wg.Wait()
+	f.OnEnd(root, rec(1, 0, sectiontrace.End, 30, true))
+}
+
+// orderChecker fails the test if a section is passed on before its
+// parent's begin record.
+type orderChecker struct {
+	t     *testing.T
+	mu    sync.Mutex
+	begun map[int32]bool
+}
+
+func (c *orderChecker) OnBegin(begin *sectiontrace.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := begin.IntArg(sectiontrace.ArgParent); ok && !c.begun[p] {
+		c.t.Errorf("section %d begun before its parent %d", begin.ID, p)
+	}
+	c.begun[begin.ID] = true
+}
+
+func (c *orderChecker) OnEnd(begin, end *sectiontrace.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.begun[end.ID] {
+		c.t.Errorf("section %d ended before it began", end.ID)
+	}
+}
@@ -0,0 +1,49 @@
+package otlp
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/export"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+var DefaultEndpoint = "http://localhost:4318/v1/traces"
+
+// Exporter is a sectiontrace.Sink that sends completed sections as
+// OTLP spans, using the OTLP/HTTP JSON encoding. Spans are sent in
+// batches, and failed requests retried; see the fields for the
+// configuration. Fields left as zero get the defaults used by
+// NewExporter, with DefaultEndpoint as the endpoint.
+type Exporter = export.Exporter[*span, format]
+
+func NewExporter(endpoint string) *Exporter {
+	return export.NewExporter[*span, format](endpoint)
+}
+
+type format struct{}
+
+func (format) DefaultEndpoint() string { return DefaultEndpoint }
+func (format) ContentType() string     { return "application/json" }
+
+func (format) Convert(begin, end *sectiontrace.Record, serviceName string) *span {
+	return convert(begin, end)
+}
+
+func (format) Encode(serviceName string, batch []*span) ([]byte, error) {
+	return json.Marshal(newRequest(serviceName, batch))
+}
+
+// WriteJSON converts records into an OTLP/JSON export request, for
+// offline conversion of trace files. Unclosed sections are skipped.
+func WriteJSON(w io.Writer, recs []*sectiontrace.Record, serviceName string) error {
+	var spans []*span
+	tree.Build(recs).Walk(func(n *tree.Node) bool {
+		if n.Closed() {
+			spans = append(spans, convert(n.Begin, n.End))
+		}
+		return true
+	})
+	return json.NewEncoder(w).Encode(newRequest(serviceName, spans))
+}
@@ -0,0 +1,172 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type fakeCollector struct {
+	mu       sync.Mutex
+	failures int
+	requests []exportRequest
+}
+
+func (f *fakeCollector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	var r exportRequest
+	if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.requests = append(f.requests, r)
+}
+
+func (f *fakeCollector) spans() []*span {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rv []*span
+	for _, r := range f.requests {
+		for _, rs := range r.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				rv = append(rv, ss.Spans...)
+			}
+		}
+	}
+	return rv
+}
+
+func pair(scope string, id int32, t0, t1 int64, args map[string]interface{}, ok bool) (*sectiontrace.Record, *sectiontrace.Record) {
+	begin := &sectiontrace.Record{Name: "sec", Scope: scope, ID: id, Phase: sectiontrace.Begin, TimestampMicros: t0, Args: map[string]interface{}{}}
+	end := &sectiontrace.Record{Name: "sec", Scope: scope, ID: id, Phase: sectiontrace.End, TimestampMicros: t1, Args: map[string]interface{}{"ok": ok}}
+	for k, v := range args {
+		begin.Args[k] = v
+		end.Args[k] = v
+	}
+	return begin, end
+}
+
+func TestExporter(t *testing.T) {
+	collector := &fakeCollector{failures: 2}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	e := NewExporter(server.URL)
+	e.ServiceName = "test"
+	e.BatchSize = 2
+	e.FlushInterval = time.Hour
+	e.RetryBackoff = time.Millisecond
+
+	e.OnEnd(pair("client", 1, 1000, 5000, nil, true))
+	e.OnEnd(pair("client", 2, 1500, 2000, map[string]interface{}{"p": int32(1), "a": int32(1), "extra": "x"}, false))
+	e.OnEnd(pair("server", 1, 1600, 1900, map[string]interface{}{
+		"rp": int32(2), "rps": "client", "ra": int32(1), "ras": "client",
+	}, true))
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := collector.spans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+
+	root, child, remote := spans[0], spans[1], spans[2]
+	if root.ParentSpanID != "" || child.ParentSpanID != root.SpanID || remote.ParentSpanID != child.SpanID {
+		t.Errorf("bad parent linkage: %+v %+v %+v", root, child, remote)
+	}
+	if root.TraceID != child.TraceID || root.TraceID != remote.TraceID {
+		t.Errorf("trace IDs differ: %q %q %q", root.TraceID, child.TraceID, remote.TraceID)
+	}
+	if child.Status.Code != statusError || root.Status.Code != statusOK {
+		t.Errorf("bad status: %+v %+v", root.Status, child.Status)
+	}
+	if root.StartTimeUnixNano != "1000000" || root.EndTimeUnixNano != "5000000" {
+		t.Errorf("bad times: %+v", root)
+	}
+
+	found := false
+	for _, attr := range child.Attributes {
+		if attr.Key == "extra" && attr.Value.StringValue != nil && *attr.Value.StringValue == "x" {
+			found = true
+		}
+		if attr.Key == "p" {
+			t.Errorf("linkage arg copied to attributes")
+		}
+	}
+	if !found {
+		t.Errorf("missing attribute: %+v", child.Attributes)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	link := sectiontrace.Link{
+		Section:    sectiontrace.NodeAndScope{Scope: "client", ID: 2},
+		Root:       sectiontrace.NodeAndScope{Scope: "client", ID: 1},
+		Attributes: map[string]interface{}{"input": "x"},
+	}
+	batch := convert(pair("batch", 1, 0, 10, map[string]interface{}{"l": []sectiontrace.Link{link}}, true))
+	child := convert(pair("client", 2, 0, 10, map[string]interface{}{"p": int32(1), "a": int32(1)}, true))
+
+	if len(batch.Links) != 1 {
+		t.Fatalf("bad links: %+v", batch.Links)
+	}
+	l := batch.Links[0]
+	if l.SpanID != child.SpanID || l.TraceID != child.TraceID {
+		t.Errorf("link %+v does not refer to %+v", l, child)
+	}
+	if len(l.Attributes) != 1 || l.Attributes[0].Key != "input" {
+		t.Errorf("bad link attributes: %+v", l.Attributes)
+	}
+}
+
+func TestFollowsFrom(t *testing.T) {
+	detached := convert(pair("client", 3, 0, 10, map[string]interface{}{"f": int32(2), "a": int32(1)}, true))
+	origin := convert(pair("client", 2, 0, 10, map[string]interface{}{"p": int32(1), "a": int32(1)}, true))
+
+	if len(detached.Links) != 1 || detached.Links[0].SpanID != origin.SpanID || detached.Links[0].TraceID != origin.TraceID {
+		t.Errorf("bad links %+v to %+v", detached.Links, origin)
+	}
+	if detached.ParentSpanID != "" || detached.TraceID != origin.TraceID {
+		t.Errorf("detached span = %+v", detached)
+	}
+}
+
+func TestExporterLiteral(t *testing.T) {
+	collector := &fakeCollector{failures: 2}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	e := &Exporter{Endpoint: server.URL, RetryBackoff: time.Millisecond}
+	e.OnEnd(pair("client", 1, 0, 10, nil, true))
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(collector.spans()); got != 1 || e.Dropped() != 0 {
+		t.Errorf("got %d spans, dropped %d", got, e.Dropped())
+	}
+
+	collector.mu.Lock()
+	collector.failures = 1
+	collector.mu.Unlock()
+	noRetries := &Exporter{Endpoint: server.URL, MaxRetries: -1}
+	noRetries.OnEnd(pair("client", 2, 0, 10, nil, true))
+	if err := noRetries.Shutdown(context.Background()); err == nil {
+		t.Errorf("failed request was retried")
+	}
+}
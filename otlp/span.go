@@ -0,0 +1,188 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/spanid"
+)
+
+// The OTLP/JSON encoding of trace data. Trace and span IDs are hex
+// strings, and 64-bit integers are decimal strings.
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	statusOK    = 1
+	statusError = 2
+
+	spanKindInternal = 1
+)
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Links             []spanLink `json:"links,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type spanLink struct {
+	TraceID    string     `json:"traceId"`
+	SpanID     string     `json:"spanId"`
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type instrumentationScope struct {
+	Name string `json:"name"`
+}
+
+type scopeSpans struct {
+	Scope instrumentationScope `json:"scope"`
+	Spans []*span              `json:"spans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+func stringAttr(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func toAnyValue(v interface{}) anyValue {
+	switch v := v.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		return anyValue{IntValue: &s}
+	case int32:
+		s := strconv.FormatInt(int64(v), 10)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	}
+	s := fmt.Sprint(v)
+	return anyValue{StringValue: &s}
+}
+
+func nanos(micros int64) string {
+	return strconv.FormatInt(micros*1000, 10)
+}
+
+// convert turns a completed section into a span.
+func convert(begin, end *sectiontrace.Record) *span {
+	traceID := spanid.Trace(begin)
+	spanID := spanid.Span(begin.Scope, begin.ID)
+
+	s := &span{
+		TraceID:           hex.EncodeToString(traceID[:]),
+		SpanID:            hex.EncodeToString(spanID[:]),
+		Name:              begin.Name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: nanos(begin.TimestampMicros),
+		EndTimeUnixNano:   nanos(end.TimestampMicros),
+		Status:            status{Code: statusOK},
+	}
+	if parent, ok := spanid.Parent(begin); ok {
+		s.ParentSpanID = hex.EncodeToString(parent[:])
+	}
+	if ok, _ := end.BoolArg(sectiontrace.ArgOK); !ok {
+		s.Status = status{Code: statusError}
+	}
+
+	s.Attributes = append(s.Attributes,
+		stringAttr("sectiontrace.category", begin.Category),
+		stringAttr("sectiontrace.scope", begin.Scope),
+		keyValue{Key: "sectiontrace.id", Value: toAnyValue(begin.ID)},
+		keyValue{Key: "process.pid", Value: toAnyValue(begin.ProcessID)},
+	)
+
+	args := end.AllArgs()
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		if !spanid.IsLinkArg(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.Attributes = append(s.Attributes, keyValue{Key: k, Value: toAnyValue(args[k])})
+	}
+
+	for _, link := range spanid.Links(begin) {
+		linkTrace, linkSpan := spanid.Link(link)
+		s.Links = append(s.Links, spanLink{
+			TraceID:    hex.EncodeToString(linkTrace[:]),
+			SpanID:     hex.EncodeToString(linkSpan[:]),
+			Attributes: attributes(link.Attributes),
+		})
+	}
+
+	return s
+}
+
+func attributes(m map[string]interface{}) []keyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var rv []keyValue
+	for _, k := range keys {
+		rv = append(rv, keyValue{Key: k, Value: toAnyValue(m[k])})
+	}
+	return rv
+}
+
+func newRequest(serviceName string, spans []*span) *exportRequest {
+	return &exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: []keyValue{stringAttr("service.name", serviceName)},
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: instrumentationScope{Name: "github.com/steinarvk/sectiontrace"},
+				Spans: spans,
+			}},
+		}},
+	}
+}
@@ -0,0 +1,295 @@
+package perfetto
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/protowire"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// Field numbers from perfetto's trace proto definitions.
+const (
+	traceFieldPacket = 1
+
+	packetTimestamp              = 8
+	packetClockSnapshot          = 6
+	packetTrustedSequenceID      = 10
+	packetTrackEvent             = 11
+	packetInternedData           = 12
+	packetSequenceFlags          = 13
+	packetTimestampClockID       = 58
+	packetTracePacketDefaults    = 59
+	packetTrackDescriptor        = 60
+	defaultsTimestampClockID     = 58
+	clockSnapshotClocks          = 1
+	clockSnapshotPrimaryClock    = 2
+	clockID                      = 1
+	clockTimestamp               = 2
+	clockIsIncremental           = 3
+	clockUnitMultiplierNs        = 4
+	trackDescriptorUUID          = 1
+	trackDescriptorName          = 2
+	trackDescriptorProcess       = 3
+	trackDescriptorParentUUID    = 5
+	processDescriptorPID         = 1
+	processDescriptorName        = 6
+	trackEventType               = 9
+	trackEventNameIID            = 10
+	trackEventTrackUUID          = 11
+	trackEventCategories         = 22
+	trackEventFlowIDs            = 47
+	trackEventTerminatingFlowIDs = 48
+	internedEventNames           = 2
+	eventNameIID                 = 1
+	eventNameName                = 2
+
+	typeSliceBegin = 1
+	typeSliceEnd   = 2
+
+	seqIncrementalStateCleared = 1
+	seqNeedsIncrementalState   = 2
+
+	builtinClockBoottime = 6
+	// incrementalClock is a sequence-scoped clock counting microseconds,
+	// where each packet's timestamp is a delta from the previous one.
+	incrementalClock = 64
+
+	sequenceID = 1
+)
+
+type event struct {
+	node  *tree.Node
+	begin bool
+	ts    int64
+}
+
+func (e event) less(o event) bool {
+	if e.ts != o.ts {
+		return e.ts < o.ts
+	}
+	if e.begin != o.begin {
+		return !e.begin
+	}
+	if e.begin {
+		return e.node.Depth < o.node.Depth
+	}
+	return e.node.Depth > o.node.Depth
+}
+
+func processUUID(pid int32) uint64 {
+	return uint64(uint32(pid))<<32 | 1<<31
+}
+
+func laneUUID(pid int32, lane int) uint64 {
+	return uint64(uint32(pid))<<32 | uint64(lane)
+}
+
+// flowID identifies the flow into a section; kind distinguishes several
+// flows into the same section.
+func flowID(n *tree.Node, kind string) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d\x00%s", n.Scope, n.ID, kind)
+	return h.Sum64()
+}
+
+func pidOf(n *tree.Node) int32 {
+	if n.Begin != nil {
+		return n.Begin.ProcessID
+	}
+	return n.End.ProcessID
+}
+
+// Write converts records to perfetto's protobuf trace format. Each
+// process gets a track, with a child track per lane of concurrently
+// running sections. Parents and children that end up in different lanes
+// are connected by flows, as are sections and the sections they follow
+// from or link to.
+func Write(w io.Writer, recs []*sectiontrace.Record) error {
+	return WriteTree(w, tree.Build(recs))
+}
+
+func WriteTree(w io.Writer, t *tree.Tree) error {
+	lanes := t.Lanes()
+
+	var events []event
+	t.Walk(func(n *tree.Node) bool {
+		if n.Begin != nil {
+			events = append(events, event{node: n, begin: true, ts: n.Start()})
+			if n.End != nil {
+				events = append(events, event{node: n, ts: n.Finish()})
+			}
+		}
+		return true
+	})
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].less(events[j])
+	})
+
+	bw := bufio.NewWriter(w)
+	var packet protowire.Buffer
+	emit := func() error {
+		var outer protowire.Buffer
+		outer.RawBytes(traceFieldPacket, packet.Bytes())
+		packet.Reset()
+		_, err := bw.Write(outer.Bytes())
+		return err
+	}
+
+	var t0 int64
+	if len(events) > 0 {
+		t0 = events[0].ts
+	}
+
+	packet.Uint64(packetTimestamp, uint64(t0*1000))
+	packet.Uint64(packetTimestampClockID, builtinClockBoottime)
+	packet.Uint64(packetTrustedSequenceID, sequenceID)
+	packet.Uint64(packetSequenceFlags, seqIncrementalStateCleared)
+	packet.Message(packetClockSnapshot, func(m *protowire.Buffer) {
+		m.Message(clockSnapshotClocks, func(c *protowire.Buffer) {
+			c.Uint64(clockID, builtinClockBoottime)
+			c.Uint64(clockTimestamp, uint64(t0*1000))
+		})
+		m.Message(clockSnapshotClocks, func(c *protowire.Buffer) {
+			c.Uint64(clockID, incrementalClock)
+			c.Uint64(clockTimestamp, uint64(t0))
+			c.Bool(clockIsIncremental, true)
+			c.Uint64(clockUnitMultiplierNs, 1000)
+		})
+		m.Uint64(clockSnapshotPrimaryClock, builtinClockBoottime)
+	})
+	packet.Message(packetTracePacketDefaults, func(m *protowire.Buffer) {
+		m.Uint64(defaultsTimestampClockID, incrementalClock)
+	})
+	if err := emit(); err != nil {
+		return err
+	}
+
+	type pidLane struct {
+		pid  int32
+		lane int
+	}
+	seenPIDs := map[int32]bool{}
+	seenLanes := map[pidLane]bool{}
+	var order []pidLane
+	for _, e := range events {
+		pl := pidLane{pidOf(e.node), lanes[e.node]}
+		if !seenLanes[pl] {
+			seenLanes[pl] = true
+			order = append(order, pl)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].pid != order[j].pid {
+			return order[i].pid < order[j].pid
+		}
+		return order[i].lane < order[j].lane
+	})
+	for _, pl := range order {
+		if !seenPIDs[pl.pid] {
+			seenPIDs[pl.pid] = true
+			pid := pl.pid
+			packet.Uint64(packetTrustedSequenceID, sequenceID)
+			packet.Message(packetTrackDescriptor, func(m *protowire.Buffer) {
+				m.Uint64(trackDescriptorUUID, processUUID(pid))
+				m.Message(trackDescriptorProcess, func(p *protowire.Buffer) {
+					p.Int32(processDescriptorPID, pid)
+					p.String(processDescriptorName, fmt.Sprintf("pid %d", pid))
+				})
+			})
+			if err := emit(); err != nil {
+				return err
+			}
+		}
+		pl := pl
+		packet.Uint64(packetTrustedSequenceID, sequenceID)
+		packet.Message(packetTrackDescriptor, func(m *protowire.Buffer) {
+			m.Uint64(trackDescriptorUUID, laneUUID(pl.pid, pl.lane))
+			m.Uint64(trackDescriptorParentUUID, processUUID(pl.pid))
+			m.String(trackDescriptorName, fmt.Sprintf("lane %d", pl.lane))
+		})
+		if err := emit(); err != nil {
+			return err
+		}
+	}
+
+	// Flows go from a parent to each child that is in another lane, and
+	// from a section to any detached sections following from it or
+	// sections linking to it.
+	flowsFrom := map[*tree.Node][]uint64{}
+	flowsInto := map[*tree.Node][]uint64{}
+	t.Walk(func(n *tree.Node) bool {
+		if n.Parent != nil && n.Parent.Begin != nil && (lanes[n] != lanes[n.Parent] || pidOf(n) != pidOf(n.Parent)) {
+			id := flowID(n, "")
+			flowsFrom[n.Parent] = append(flowsFrom[n.Parent], id)
+			flowsInto[n] = append(flowsInto[n], id)
+		}
+		if n.FollowsFrom != nil && n.FollowsFrom.Begin != nil {
+			id := flowID(n, sectiontrace.ArgFollowsFrom)
+			flowsFrom[n.FollowsFrom] = append(flowsFrom[n.FollowsFrom], id)
+			flowsInto[n] = append(flowsInto[n], id)
+		}
+		for _, target := range n.Links {
+			if target.Begin == nil {
+				continue
+			}
+			id := flowID(n, fmt.Sprintf("%s\x00%s\x00%d", sectiontrace.ArgLinks, target.Scope, target.ID))
+			flowsFrom[target] = append(flowsFrom[target], id)
+			flowsInto[n] = append(flowsInto[n], id)
+		}
+		return true
+	})
+
+	nameIIDs := map[string]uint64{}
+	prev := t0
+	for _, e := range events {
+		n := e.node
+		packet.Uint64(packetTimestamp, uint64(e.ts-prev))
+		prev = e.ts
+		packet.Uint64(packetTrustedSequenceID, sequenceID)
+		packet.Uint64(packetSequenceFlags, seqNeedsIncrementalState)
+
+		var newName bool
+		iid, ok := nameIIDs[n.Name]
+		if e.begin && !ok {
+			iid = uint64(len(nameIIDs) + 1)
+			nameIIDs[n.Name] = iid
+			newName = true
+		}
+
+		track := laneUUID(pidOf(n), lanes[n])
+		packet.Message(packetTrackEvent, func(m *protowire.Buffer) {
+			m.Uint64(trackEventTrackUUID, track)
+			if !e.begin {
+				m.Uint64(trackEventType, typeSliceEnd)
+				return
+			}
+			m.Uint64(trackEventType, typeSliceBegin)
+			m.Uint64(trackEventNameIID, iid)
+			m.String(trackEventCategories, n.Begin.Category)
+			for _, id := range flowsFrom[n] {
+				m.Fixed64(trackEventFlowIDs, id)
+			}
+			for _, id := range flowsInto[n] {
+				m.Fixed64(trackEventTerminatingFlowIDs, id)
+			}
+		})
+		if newName {
+			packet.Message(packetInternedData, func(m *protowire.Buffer) {
+				m.Message(internedEventNames, func(en *protowire.Buffer) {
+					en.Uint64(eventNameIID, iid)
+					en.String(eventNameName, n.Name)
+				})
+			})
+		}
+		if err := emit(); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
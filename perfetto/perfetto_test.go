@@ -0,0 +1,120 @@
+package perfetto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type field struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+func decode(t *testing.T, data []byte) []field {
+	var rv []field
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad tag")
+		}
+		data = data[n:]
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(data)
+			data = data[n:]
+		case 1:
+			f.value = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			f.bytes = data[n : n+int(l)]
+			data = data[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		rv = append(rv, f)
+	}
+	return rv
+}
+
+func find(fields []field, num int) []field {
+	var rv []field
+	for _, f := range fields {
+		if f.num == num {
+			rv = append(rv, f)
+		}
+	}
+	return rv
+}
+
+func TestWrite(t *testing.T) {
+	r := func(name string, id int32, phase sectiontrace.Phase, ts int64, parent int32) *sectiontrace.Record {
+		args := map[string]interface{}{}
+		if parent != 0 {
+			args["p"] = parent
+		}
+		return &sectiontrace.Record{Name: name, ID: id, Phase: phase, TimestampMicros: ts, ProcessID: 9, Args: args}
+	}
+	recs := []*sectiontrace.Record{
+		r("root", 1, sectiontrace.Begin, 1000, 0),
+		r("worker", 2, sectiontrace.Begin, 1010, 1),
+		r("worker", 3, sectiontrace.Begin, 1020, 1),
+		r("worker", 2, sectiontrace.End, 1050, 1),
+		r("worker", 3, sectiontrace.End, 1060, 1),
+		r("root", 1, sectiontrace.End, 1100, 0),
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	packets := find(decode(t, buf.Bytes()), traceFieldPacket)
+	// Clock snapshot, process track, two lane tracks and six events.
+	if len(packets) != 10 {
+		t.Fatalf("got %d packets", len(packets))
+	}
+
+	var deltas []uint64
+	var names []string
+	flows, terminating := 0, 0
+	for _, p := range packets[4:] {
+		fields := decode(t, p.bytes)
+		deltas = append(deltas, find(fields, packetTimestamp)[0].value)
+		for _, interned := range find(fields, packetInternedData) {
+			for _, en := range find(decode(t, interned.bytes), internedEventNames) {
+				names = append(names, string(find(decode(t, en.bytes), eventNameName)[0].bytes))
+			}
+		}
+		ev := decode(t, find(fields, packetTrackEvent)[0].bytes)
+		flows += len(find(ev, trackEventFlowIDs))
+		terminating += len(find(ev, trackEventTerminatingFlowIDs))
+	}
+
+	if got, want := deltas, []uint64{0, 10, 10, 30, 10, 40}; !equal(got, want) {
+		t.Errorf("deltas = %v want %v", got, want)
+	}
+	if len(names) != 2 || names[0] != "root" || names[1] != "worker" {
+		t.Errorf("interned names = %v", names)
+	}
+	if flows != 1 || terminating != 1 {
+		t.Errorf("flows = %d, terminating = %d", flows, terminating)
+	}
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
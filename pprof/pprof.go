@@ -0,0 +1,172 @@
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/protowire"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// The sample values, in order. The default sample type is self time, so
+// that pprof's flat and cumulative columns behave as they do for CPU
+// profiles.
+var sampleTypes = [][2]string{
+	{"self", "nanoseconds"},
+	{"wall", "nanoseconds"},
+	{"calls", "count"},
+	{"errors", "count"},
+}
+
+// Write converts records into a gzipped profile.proto, suitable for
+// "go tool pprof". Each sample's stack is the chain of section names
+// from the root down to a section.
+func Write(w io.Writer, recs []*sectiontrace.Record) error {
+	return WriteTree(w, tree.Build(recs))
+}
+
+func WriteTree(w io.Writer, t *tree.Tree) error {
+	p := newBuilder()
+	t.Walk(func(n *tree.Node) bool {
+		if n.Closed() {
+			p.add(n)
+		}
+		return true
+	})
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type sample struct {
+	locations []uint64
+	values    []int64
+}
+
+type builder struct {
+	strings    []string
+	stringIDs  map[string]int64
+	functions  map[string]uint64
+	funcNames  []string
+	samples    map[string]*sample
+	order      []string
+	start, end int64
+}
+
+func newBuilder() *builder {
+	return &builder{
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		functions: map[string]uint64{},
+		samples:   map[string]*sample{},
+	}
+}
+
+func (p *builder) str(s string) int64 {
+	if id, ok := p.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(p.strings))
+	p.strings = append(p.strings, s)
+	p.stringIDs[s] = id
+	return id
+}
+
+// function returns the ID of the function for a section name. Function
+// and location IDs are the same, since each location has a single line.
+func (p *builder) function(name string) uint64 {
+	if id, ok := p.functions[name]; ok {
+		return id
+	}
+	p.funcNames = append(p.funcNames, name)
+	id := uint64(len(p.funcNames))
+	p.functions[name] = id
+	return id
+}
+
+func (p *builder) add(n *tree.Node) {
+	if len(p.order) == 0 || n.Start() < p.start {
+		p.start = n.Start()
+	}
+	if n.Finish() > p.end {
+		p.end = n.Finish()
+	}
+
+	path := n.Path()
+	key := strings.Join(path, "\x00")
+	s, ok := p.samples[key]
+	if !ok {
+		s = &sample{values: make([]int64, len(sampleTypes))}
+		for i := len(path) - 1; i >= 0; i-- {
+			s.locations = append(s.locations, p.function(path[i]))
+		}
+		p.samples[key] = s
+		p.order = append(p.order, key)
+	}
+
+	s.values[0] += n.SelfTime().Nanoseconds()
+	s.values[1] += n.Duration().Nanoseconds()
+	s.values[2]++
+	if !n.OK() {
+		s.values[3]++
+	}
+}
+
+func (p *builder) encode() []byte {
+	var b protowire.Buffer
+
+	for _, st := range sampleTypes {
+		typ, unit := p.str(st[0]), p.str(st[1])
+		b.Message(1, func(m *protowire.Buffer) {
+			m.Int64(1, typ)
+			m.Int64(2, unit)
+		})
+	}
+
+	for _, key := range p.order {
+		s := p.samples[key]
+		b.Message(2, func(m *protowire.Buffer) {
+			m.PackedUint64s(1, s.locations)
+			m.PackedInt64s(2, s.values)
+		})
+	}
+
+	for i, name := range p.funcNames {
+		id := uint64(i + 1)
+		b.Message(4, func(m *protowire.Buffer) {
+			m.Uint64(1, id)
+			m.Message(4, func(line *protowire.Buffer) {
+				line.Uint64(1, id)
+			})
+		})
+		nameID := p.str(name)
+		b.Message(5, func(m *protowire.Buffer) {
+			m.Uint64(1, id)
+			m.Int64(2, nameID)
+			m.Int64(3, nameID)
+		})
+	}
+
+	periodType, periodUnit := p.str("wall"), p.str("nanoseconds")
+	defaultType := p.str(sampleTypes[0][0])
+
+	for _, s := range p.strings {
+		b.String(6, s)
+	}
+
+	b.Int64(9, p.start*1000)
+	b.Int64(10, (p.end-p.start)*1000)
+	b.Message(11, func(m *protowire.Buffer) {
+		m.Int64(1, periodType)
+		m.Int64(2, periodUnit)
+	})
+	b.Int64(12, 1)
+	b.Int64(14, defaultType)
+
+	return b.Bytes()
+}
@@ -0,0 +1,153 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type field struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+func decode(t *testing.T, data []byte) []field {
+	var rv []field
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatalf("bad tag")
+		}
+		data = data[n:]
+		f := field{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.value, n = binary.Uvarint(data)
+			data = data[n:]
+		case 2:
+			l, n := binary.Uvarint(data)
+			f.bytes = data[n : n+int(l)]
+			data = data[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		rv = append(rv, f)
+	}
+	return rv
+}
+
+func packed(data []byte) []uint64 {
+	var rv []uint64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		rv = append(rv, v)
+		data = data[n:]
+	}
+	return rv
+}
+
+// stacks decodes a profile into the sample values of each stack, keyed
+// by the section names from the root down, and returns the sample type
+// names.
+func stacks(t *testing.T, data []byte) (map[string][]int64, []string) {
+	var strs []string
+	funcNames := map[uint64]int64{}
+	locFuncs := map[uint64]uint64{}
+	var types []string
+	var samples [][2][]uint64
+
+	fields := decode(t, data)
+	for _, f := range fields {
+		if f.num == 6 {
+			strs = append(strs, string(f.bytes))
+		}
+	}
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			for _, sf := range decode(t, f.bytes) {
+				if sf.num == 1 {
+					types = append(types, strs[sf.value])
+				}
+			}
+		case 2:
+			var s [2][]uint64
+			for _, sf := range decode(t, f.bytes) {
+				s[sf.num-1] = packed(sf.bytes)
+			}
+			samples = append(samples, s)
+		case 4:
+			var id uint64
+			for _, lf := range decode(t, f.bytes) {
+				switch lf.num {
+				case 1:
+					id = lf.value
+				case 4:
+					locFuncs[id] = decode(t, lf.bytes)[0].value
+				}
+			}
+		case 5:
+			sub := decode(t, f.bytes)
+			funcNames[sub[0].value] = int64(sub[1].value)
+		}
+	}
+
+	rv := map[string][]int64{}
+	for _, s := range samples {
+		var names []string
+		for i := len(s[0]) - 1; i >= 0; i-- {
+			names = append(names, strs[funcNames[locFuncs[s[0][i]]]])
+		}
+		values := make([]int64, len(s[1]))
+		for i, v := range s[1] {
+			values[i] = int64(v)
+		}
+		rv[strings.Join(names, ";")] = values
+	}
+	return rv, types
+}
+
+func TestWrite(t *testing.T) {
+	inner := map[string]interface{}{"p": int32(1)}
+	recs := []*sectiontrace.Record{
+		{Name: "outer", ID: 1, Phase: sectiontrace.Begin, TimestampMicros: 0, Args: map[string]interface{}{}},
+		{Name: "inner", ID: 2, Phase: sectiontrace.Begin, TimestampMicros: 10, Args: inner},
+		{Name: "inner", ID: 2, Phase: sectiontrace.End, TimestampMicros: 40, Args: map[string]interface{}{"p": int32(1), "ok": true}},
+		{Name: "inner", ID: 3, Phase: sectiontrace.Begin, TimestampMicros: 50, Args: inner},
+		{Name: "inner", ID: 3, Phase: sectiontrace.End, TimestampMicros: 70, Args: map[string]interface{}{"p": int32(1), "ok": false}},
+		{Name: "outer", ID: 1, Phase: sectiontrace.End, TimestampMicros: 100, Args: map[string]interface{}{"ok": true}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, recs); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, types := stacks(t, data)
+	if want := []string{"self", "wall", "calls", "errors"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("sample types = %v want %v", types, want)
+	}
+	want := map[string][]int64{
+		"outer":       {50000, 100000, 1, 0},
+		"outer;inner": {50000, 50000, 2, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples = %v want %v", got, want)
+	}
+}
@@ -0,0 +1,176 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+var DefaultBuckets = []float64{
+	.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+var DefaultMaxSections = 500
+
+// OverflowLabel is the section label used for sections seen after
+// MaxSections distinct names have been exported.
+const OverflowLabel = "__overflow__"
+
+type series struct {
+	buckets []uint64
+	count   uint64
+	errors  uint64
+	sum     float64
+}
+
+// Exporter is a sectiontrace.Sink that exposes per-section metrics in
+// the Prometheus text exposition format.
+type Exporter struct {
+	// Prefix is prepended to all metric names.
+	Prefix string
+	// Buckets are the upper bounds of the duration histogram buckets,
+	// in seconds. They must not be changed after the first section ends.
+	Buckets []float64
+	// MaxSections limits the number of distinct section labels, to
+	// protect against unbounded cardinality from dynamically named
+	// sections. Sections beyond the limit are counted under
+	// OverflowLabel.
+	MaxSections int
+
+	mu       sync.Mutex
+	byName   map[string]*series
+	overflow *series
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{
+		Prefix:      "sectiontrace",
+		Buckets:     DefaultBuckets,
+		MaxSections: DefaultMaxSections,
+		byName:      map[string]*series{},
+	}
+}
+
+func (e *Exporter) OnBegin(begin *sectiontrace.Record) {}
+
+func (e *Exporter) OnEnd(begin, end *sectiontrace.Record) {
+	seconds := float64(end.TimestampMicros-begin.TimestampMicros) / 1e6
+	ok, _ := end.BoolArg(sectiontrace.ArgOK)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := e.seriesFor(end.Name)
+	s.count++
+	s.sum += seconds
+	if !ok {
+		s.errors++
+	}
+	for i, bound := range e.Buckets {
+		if seconds <= bound {
+			s.buckets[i]++
+		}
+	}
+}
+
+func (e *Exporter) seriesFor(name string) *series {
+	if s, ok := e.byName[name]; ok {
+		return s
+	}
+	if len(e.byName) >= e.MaxSections {
+		if e.overflow == nil {
+			e.overflow = e.newSeries()
+		}
+		return e.overflow
+	}
+	s := e.newSeries()
+	e.byName[name] = s
+	return s
+}
+
+func (e *Exporter) newSeries() *series {
+	return &series{buckets: make([]uint64, len(e.Buckets))}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// WriteText writes all metrics in the Prometheus text format.
+func (e *Exporter) WriteText(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.byName))
+	for name := range e.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type labelled struct {
+		label string
+		s     *series
+	}
+	all := make([]labelled, 0, len(names)+1)
+	for _, name := range names {
+		all = append(all, labelled{name, e.byName[name]})
+	}
+	if e.overflow != nil {
+		all = append(all, labelled{OverflowLabel, e.overflow})
+	}
+
+	bw := bufio.NewWriter(w)
+
+	duration := e.Prefix + "_section_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Time spent in sections.\n", duration)
+	fmt.Fprintf(bw, "# TYPE %s histogram\n", duration)
+	for _, l := range all {
+		label := escapeLabel(l.label)
+		for i, bound := range e.Buckets {
+			fmt.Fprintf(bw, "%s_bucket{section=\"%s\",le=\"%s\"} %d\n", duration, label, formatFloat(bound), l.s.buckets[i])
+		}
+		fmt.Fprintf(bw, "%s_bucket{section=\"%s\",le=\"+Inf\"} %d\n", duration, label, l.s.count)
+		fmt.Fprintf(bw, "%s_sum{section=\"%s\"} %s\n", duration, label, formatFloat(l.s.sum))
+		fmt.Fprintf(bw, "%s_count{section=\"%s\"} %d\n", duration, label, l.s.count)
+	}
+
+	calls := e.Prefix + "_section_calls_total"
+	fmt.Fprintf(bw, "# HELP %s Number of sections ended.\n", calls)
+	fmt.Fprintf(bw, "# TYPE %s counter\n", calls)
+	for _, l := range all {
+		fmt.Fprintf(bw, "%s{section=\"%s\"} %d\n", calls, escapeLabel(l.label), l.s.count)
+	}
+
+	errors := e.Prefix + "_section_errors_total"
+	fmt.Fprintf(bw, "# HELP %s Number of sections ended with an error.\n", errors)
+	fmt.Fprintf(bw, "# TYPE %s counter\n", errors)
+	for _, l := range all {
+		fmt.Fprintf(bw, "%s{section=\"%s\"} %d\n", errors, escapeLabel(l.label), l.s.errors)
+	}
+
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,47 @@
+package prometheus
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func end(e *Exporter, name string, micros int64, ok bool) {
+	begin := &sectiontrace.Record{Name: name, Phase: sectiontrace.Begin, Args: map[string]interface{}{}}
+	endRec := &sectiontrace.Record{Name: name, Phase: sectiontrace.End, TimestampMicros: micros, Args: map[string]interface{}{"ok": ok}}
+	e.OnEnd(begin, endRec)
+}
+
+func TestExposition(t *testing.T) {
+	e := NewExporter()
+	e.Buckets = []float64{0.001, 0.01}
+	e.MaxSections = 2
+
+	end(e, "a", 500, true)
+	end(e, "a", 5000, false)
+	end(e, `b"quoted"`, 50000, true)
+	end(e, "c", 1, true)
+	end(e, "d", 1, true)
+
+	var buf bytes.Buffer
+	if err := e.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`sectiontrace_section_duration_seconds_bucket{section="a",le="0.001"} 1`,
+		`sectiontrace_section_duration_seconds_bucket{section="a",le="0.01"} 2`,
+		`sectiontrace_section_duration_seconds_bucket{section="a",le="+Inf"} 2`,
+		`sectiontrace_section_duration_seconds_sum{section="a"} 0.0055`,
+		`sectiontrace_section_errors_total{section="a"} 1`,
+		`sectiontrace_section_calls_total{section="b\"quoted\""} 1`,
+		`sectiontrace_section_calls_total{section="__overflow__"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %q in output:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sectiontrace
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Sampler decides whether a trace is recorded. It is consulted once per
+// root section; the decision is inherited by all sections begun from the
+// returned context, and propagated through RemoteInfo.
+type Sampler interface {
+	ShouldSample(rootName string) bool
+}
+
+// DefaultSampler is consulted for every root section. If nil, every
+// trace is sampled.
+var DefaultSampler Sampler
+
+type SamplerFunc func(rootName string) bool
+
+func (f SamplerFunc) ShouldSample(rootName string) bool {
+	return f(rootName)
+}
+
+var AlwaysSample Sampler = SamplerFunc(func(string) bool { return true })
+var NeverSample Sampler = SamplerFunc(func(string) bool { return false })
+
+// ProbabilitySampler samples each trace independently with probability p.
+func ProbabilitySampler(p float64) Sampler {
+	return SamplerFunc(func(string) bool {
+		return rand.Float64() < p
+	})
+}
+
+type rateLimitSampler struct {
+	mu        sync.Mutex
+	perSecond float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+}
+
+// RateLimitSampler samples at most perSecond traces per second on
+// average, allowing bursts of up to burst traces.
+func RateLimitSampler(perSecond float64, burst int) Sampler {
+	return &rateLimitSampler{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+	}
+}
+
+func (s *rateLimitSampler) ShouldSample(string) bool {
+	now := getTimeNow()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.last.IsZero() {
+		s.tokens += now.Sub(s.last).Seconds() * s.perSecond
+		if s.tokens > s.burst {
+			s.tokens = s.burst
+		}
+	}
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// PerNameSampler picks a sampler by the name of the root section,
+// falling back to Default (or sampling everything, if Default is nil).
+type PerNameSampler struct {
+	ByName  map[string]Sampler
+	Default Sampler
+}
+
+func (s *PerNameSampler) ShouldSample(rootName string) bool {
+	if sampler, ok := s.ByName[rootName]; ok {
+		return sampler.ShouldSample(rootName)
+	}
+	if s.Default == nil {
+		return true
+	}
+	return s.Default.ShouldSample(rootName)
+}
+
+// sampledOutState is the state of every context in a trace that was not
+// sampled.
+var sampledOutState = sectionState{sampledOut: true}
+
+// sampledOutContext marks a context as belonging to a trace that was not
+// sampled. It is also used, converted to sampledOutSection, as the
+// ActiveSection for sections in that trace, so that beginning a section
+// from it allocates nothing.
+type sampledOutContext struct {
+	context.Context
+}
+
+func (c *sampledOutContext) Value(key interface{}) interface{} {
+	if key == (sectionStateKey{}) {
+		return &sampledOutState
+	}
+	if _, ok := sampledOutState.legacyValue(key); ok {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+type sampledOutSection sampledOutContext
+
+func (s *sampledOutSection) End(err error) {}
+
+func (s *sampledOutSection) NextPhase(next Section) (context.Context, ActiveSection) {
+	return next.Begin((*sampledOutContext)(s))
+}
+
+func (s *sampledOutSection) GetBeginRecord() *Record {
+	return nil
+}
+
+// IsSampledOut reports whether sections begun from ctx are not recorded.
+func IsSampledOut(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	s, ok := ctx.Value(sectionStateKey{}).(*sectionState)
+	return ok && s.sampledOut
+}
+
+func withSampledOut(ctx context.Context) *sampledOutContext {
+	if c, ok := ctx.(*sampledOutContext); ok {
+		return c
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &sampledOutContext{ctx}
+}
+
+// shouldSample decides whether a section begun with the given state is
+// recorded, consulting DefaultSampler if it starts a new trace.
+func shouldSample(state *sectionState, name string) bool {
+	if state.sampledOut {
+		return false
+	}
+	if DefaultSampler == nil || !state.isRoot() {
+		return true
+	}
+	return DefaultSampler.ShouldSample(name)
+}
+
+func beginSampledOut(ctx context.Context) (context.Context, ActiveSection) {
+	c := withSampledOut(ctx)
+	if ctx == nil {
+		return nil, (*sampledOutSection)(c)
+	}
+	return c, (*sampledOutSection)(c)
+}
@@ -0,0 +1,137 @@
+package sectiontrace
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSampledOut(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	collectedRecords = nil
+	DefaultSampler = &PerNameSampler{ByName: map[string]Sampler{"noisy": NeverSample}}
+	defer func() { DefaultSampler = nil }()
+
+	noisy := New("noisy")
+	child := New("noisy.child")
+	quiet := New("quiet")
+
+	calls := 0
+	err := noisy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if !IsSampledOut(ctx) {
+			t.Errorf("context not marked as sampled out")
+		}
+		ctx2, sec := child.Begin(ctx)
+		if ctx2 != ctx {
+			t.Errorf("child of sampled-out section got a new context")
+		}
+		_, sec = sec.NextPhase(child)
+		sec.End(nil)
+
+		info := OutgoingRemoteInfo(ctx)
+		if info == nil || !info.SampledOut {
+			t.Errorf("outgoing remote info = %+v", info)
+		}
+		return context.Canceled
+	})
+	if calls != 1 || err != context.Canceled {
+		t.Errorf("Do: calls = %d, err = %v", calls, err)
+	}
+
+	_ = quiet.Do(context.Background(), func(ctx context.Context) error {
+		if IsSampledOut(ctx) {
+			t.Errorf("quiet section sampled out")
+		}
+		return nil
+	})
+
+	if len(collectedRecords) != 2 || collectedRecords[0].Name != "quiet" {
+		t.Errorf("records = %+v", collectedRecords)
+	}
+}
+
+func TestSampledOutRemoteInfo(t *testing.T) {
+	collectedRecords = nil
+
+	data, err := json.Marshal(&RemoteInfo{SampledOut: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info RemoteInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ContextWithRemoteInfo(context.Background(), &info)
+	_ = New("server").Do(ctx, func(ctx context.Context) error {
+		return nil
+	})
+	if len(collectedRecords) != 0 {
+		t.Errorf("records = %+v", collectedRecords)
+	}
+
+	got, err := RemoteInfoFromContext(ctx)
+	if err != nil || got == nil || !got.SampledOut {
+		t.Errorf("RemoteInfoFromContext = %+v, %v", got, err)
+	}
+}
+
+func TestRateLimitSampler(t *testing.T) {
+	currentTestTime = time.Unix(1230, 0)
+	s := RateLimitSampler(10, 2)
+
+	sampled := 0
+	for i := 0; i < 10; i++ {
+		if s.ShouldSample("x") {
+			sampled++
+		}
+	}
+	if sampled != 2 {
+		t.Errorf("sampled %d of a burst, want 2", sampled)
+	}
+
+	currentTestTime = currentTestTime.Add(100 * time.Millisecond)
+	if !s.ShouldSample("x") || s.ShouldSample("x") {
+		t.Errorf("want exactly one trace sampled after 100ms")
+	}
+}
+
+func TestNoHooksKeepsLinkage(t *testing.T) {
+	collectedRecords = nil
+	usageErrors = nil
+	defer func() { usageErrors = nil }()
+
+	var info *RemoteInfo
+	var sec ActiveSection
+	withHooks(nil, nil, func() {
+		var ctx context.Context
+		ctx, sec = New("unrecorded").Begin(context.Background())
+		if IsSampledOut(ctx) {
+			t.Errorf("context without hooks marked as sampled out")
+		}
+		if _, ok := ParentID(ctx); !ok {
+			t.Errorf("no parent ID without hooks")
+		}
+		info = OutgoingRemoteInfo(ctx)
+	})
+	if info == nil || info.SampledOut || info.Parent.ID == 0 {
+		t.Errorf("outgoing remote info without hooks = %+v", info)
+	}
+
+	// Sections begun once hooks are installed are recorded, linked to
+	// the section begun before.
+	_ = New("recorded").Do(ContextWithRemoteInfo(context.Background(), info), func(context.Context) error { return nil })
+	if len(collectedRecords) != 2 || collectedRecords[0].AllArgs()[ArgRemoteParent] != info.Parent.ID {
+		t.Errorf("records = %+v", collectedRecords)
+	}
+
+	withHooks(nil, nil, func() {
+		sec.End(nil)
+		sec.End(nil)
+	})
+	if len(usageErrors) != 1 {
+		t.Errorf("double End without hooks not reported: %v", usageErrors)
+	}
+}
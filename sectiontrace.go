@@ -3,6 +3,7 @@ package sectiontrace
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -10,6 +11,14 @@ type ActiveSection interface {
 	End(err error)
 	NextPhase(Section) (context.Context, ActiveSection)
 	GetBeginRecord() *Record
+
+	// SetArg adds an arg to the section's end record. SetError marks
+	// the section as failed even if it is ended with a nil error.
+	// Mark records an instant event within the section. They are safe
+	// to call concurrently, and do nothing once the section has ended.
+	SetArg(key string, value interface{})
+	SetError(err error)
+	Mark(name string)
 }
 
 type Section interface {
@@ -33,18 +42,101 @@ type namedSection struct {
 	name string
 }
 
+// activeSection is both the context returned by Begin and the
+// ActiveSection handle, and holds the section's begin and end records,
+// with their args in typed form. Sections are allocated in blocks, so
+// that recording one allocates nothing most of the time. They are never
+// reused, since both contexts and records may outlive the section.
 type activeSection struct {
-	kind            *namedSection
-	t0, t1          time.Time
-	nodeID          int32
-	beginRec        *Record
-	hasParent       bool
-	originalContext context.Context
-	wasClosed       bool
+	context.Context
+
+	kind   *namedSection
+	t0, t1 time.Time
+	nodeID int32
+	state  sectionState
+	child  sectionState
+
+	mu          sync.Mutex
+	beginRec    Record
+	hasBeginRec bool
+	endRec      Record
+	extraArgs   map[string]interface{}
+	failed      bool
+	wasClosed   bool
+}
+
+// sectionBlockSize is the number of sections allocated at once.
+const sectionBlockSize = 32
+
+type sectionBlock struct {
+	sections [sectionBlockSize]activeSection
+	used     int
+}
+
+// sectionBlocks holds the blocks with sections left, so that each block
+// is only handed out by one goroutine at a time.
+var sectionBlocks sync.Pool
+
+func newActiveSection() *activeSection {
+	b, _ := sectionBlocks.Get().(*sectionBlock)
+	if b == nil {
+		b = &sectionBlock{}
+	}
+	a := &b.sections[b.used]
+	b.used++
+	if b.used < sectionBlockSize {
+		sectionBlocks.Put(b)
+	}
+	return a
+}
+
+func (a *activeSection) Value(key interface{}) interface{} {
+	if key == (sectionStateKey{}) {
+		return &a.child
+	}
+	if v, ok := a.child.legacyValue(key); ok {
+		return v
+	}
+	if a.Context == nil {
+		return nil
+	}
+	return a.Context.Value(key)
+}
+
+// inherit sets the state passed on to sections begun within this one.
+func (a *activeSection) inherit() {
+	a.child = sectionState{
+		parent:      a.nodeID,
+		hasParent:   true,
+		ancestor:    a.state.ancestor,
+		hasAncestor: a.state.hasAncestor,
+		remote:      a.state.remote,
+		current:     a,
+	}
+	if !a.child.hasAncestor {
+		a.child.ancestor = a.nodeID
+		a.child.hasAncestor = true
+	}
 }
 
 func (a *activeSection) GetBeginRecord() *Record {
-	return a.beginRec
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.hasBeginRec {
+		a.beginRec = Record{
+			Category:        DefaultCategory,
+			Name:            a.kind.name,
+			ID:              a.nodeID,
+			Phase:           Begin,
+			Scope:           DefaultScope,
+			TimestampMicros: a.t0.UnixNano() / 1000,
+			ProcessID:       ProcessID,
+			typed:           typedArgs{state: &a.state},
+		}
+		a.hasBeginRec = true
+	}
+	return &a.beginRec
 }
 
 func makeRecord(name string, id int32, phase Phase, t time.Time) *Record {
@@ -78,81 +170,93 @@ var getTimeNow func() time.Time = func() time.Time {
 }
 
 func (n *namedSection) Begin(ctx context.Context) (context.Context, ActiveSection) {
-	originalCtx := ctx
-
-	t0 := getTimeNow()
-	thisNodeID := generateNodeID()
-	rec := makeRecord(n.name, thisNodeID, Begin, t0)
-
-	if ctx != nil {
-		if err := setArgsFromContext(ctx, rec.Args); err != nil {
-			doPanic(err)
-			return nil, nil
-		}
+	state, err := stateFromContext(ctx)
+	if err != nil {
+		doPanic(err)
+		return nil, nil
+	}
+	if !shouldSample(&state, n.name) {
+		return beginSampledOut(ctx)
 	}
 
-	_, hasParent := rec.Args[ArgParent]
+	t0 := getTimeNow()
 
-	if ctx != nil {
-		ctx = context.WithValue(ctx, ParentNodeContextKey, thisNodeID)
-		if !hasParent {
-			ctx = context.WithValue(ctx, AncestorNodeContextKey, thisNodeID)
-		}
-	}
+	a := newActiveSection()
+	a.Context = ctx
+	a.kind = n
+	a.t0 = t0
+	a.nodeID = generateNodeID()
+	a.state = state
+	a.inherit()
 
 	if OnBegin != nil {
-		OnBegin(rec)
+		OnBegin(a.GetBeginRecord())
 	}
 
-	t1 := getTimeNow()
+	a.t1 = getTimeNow()
 
-	return ctx, &activeSection{
-		kind:            n,
-		t0:              t0,
-		t1:              t1,
-		nodeID:          thisNodeID,
-		beginRec:        rec,
-		hasParent:       hasParent,
-		originalContext: originalCtx,
+	if ctx == nil {
+		return nil, a
 	}
+	return a, a
 }
 
 func (a *activeSection) NextPhase(next Section) (context.Context, ActiveSection) {
 	a.End(nil)
-	return next.Begin(a.originalContext)
+	return next.Begin(a.Context)
 }
 
 func (a *activeSection) End(sectionError error) {
+	a.mu.Lock()
 	if a.wasClosed {
+		a.mu.Unlock()
 		doUsageError(fmt.Errorf("Section %q closed twice (did variable get resolved before rebinding?)", a.kind.name))
 		return
 	}
 	a.wasClosed = true
+	failed := a.failed
+	// extraArgs is no longer modified once the section is closed.
+	extraArgs := a.extraArgs
+	a.mu.Unlock()
 
 	t2 := getTimeNow()
 
-	sectionOK := sectionError == nil
-	endRec := makeRecord(a.kind.name, a.nodeID, End, t2)
-	for k, v := range a.beginRec.Args {
-		endRec.Args[k] = v
-	}
-	endRec.Args[ArgOK] = sectionOK
-
 	if OnEnd != nil {
-		OnEnd(a.beginRec, endRec)
+		beginRec := a.GetBeginRecord()
+		a.endRec = *beginRec
+		a.endRec.Phase = End
+		a.endRec.TimestampMicros = t2.UnixNano() / 1000
+		if len(beginRec.Args) > 0 {
+			a.endRec.Args = make(map[string]interface{}, len(beginRec.Args))
+			for k, v := range beginRec.Args {
+				a.endRec.Args[k] = v
+			}
+		}
+		a.endRec.typed = typedArgs{
+			state: &a.state,
+			extra: extraArgs,
+			ok:    sectionError == nil && !failed,
+			hasOK: true,
+		}
+
+		OnEnd(beginRec, &a.endRec)
 	}
 
-	timeSpentInternal := t2.Sub(a.t1)
+	if OnTimeSpent != nil {
+		timeSpentInternal := t2.Sub(a.t1)
 
-	t3 := getTimeNow()
+		t3 := getTimeNow()
 
-	timeSpentOverhead := t3.Sub(a.t0) - timeSpentInternal
-	if OnTimeSpent != nil {
-		OnTimeSpent(timeSpentOverhead, timeSpentInternal, a.hasParent)
+		timeSpentOverhead := t3.Sub(a.t0) - timeSpentInternal
+		OnTimeSpent(timeSpentOverhead, timeSpentInternal, a.state.hasParent)
 	}
 }
 
 func (n *namedSection) Do(ctx context.Context, callback func(context.Context) error) error {
+	if IsSampledOut(ctx) {
+		return callback(ctx)
+	}
+
 	ctx, running := n.Begin(ctx)
 
 	callbackError := callback(ctx)
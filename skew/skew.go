@@ -0,0 +1,300 @@
+// Package skew estimates clock offsets between linked processes.
+//
+// Every section started from a RemoteInfo (a "server" section) should
+// lie within its remote parent (the "client" section). Each such pair
+// bounds the offset between the two scopes' clocks: adding the offset
+// to the server's timestamps must place it inside the client. Assuming
+// network delays are roughly symmetric, the middle of that range is the
+// best single guess.
+package skew
+
+import (
+	"sort"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// Pair is one client/server observation. Lo and Hi bound the offset
+// that must be added to the server scope's clock, relative to the
+// client scope's clock, for the server section to fit in the client.
+type Pair struct {
+	ClientScope string
+	ClientID    int32
+	ServerScope string
+	ServerID    int32
+	Lo, Hi      time.Duration
+}
+
+func (p Pair) midpoint() time.Duration {
+	return p.Lo + (p.Hi-p.Lo)/2
+}
+
+// Offset is the estimated correction for one scope's clock.
+type Offset struct {
+	Scope string
+	// Reference is the scope whose clock the offset is relative to.
+	Reference string
+	// Offset should be added to the scope's timestamps.
+	Offset time.Duration
+	// Lo and Hi bound the offset, given the consistent pairs along the
+	// path to the reference scope.
+	Lo, Hi time.Duration
+	// Pairs is the number of pairs that determined the offset relative
+	// to the previous scope on the path from the reference.
+	Pairs int
+}
+
+type Result struct {
+	Offsets map[string]*Offset
+	// Inconsistent pairs could not be reconciled with the estimate,
+	// e.g. because the server section is longer than its client.
+	Inconsistent []Pair
+}
+
+type key struct {
+	scope string
+	id    int32
+}
+
+type span struct {
+	begin, end     int64
+	opened, closed bool
+}
+
+// Pairs finds all client/server pairs spanning two different scopes.
+func Pairs(recs []*sectiontrace.Record) []Pair {
+	spans := map[key]*span{}
+	for _, rec := range recs {
+		k := key{rec.Scope, rec.ID}
+		s, ok := spans[k]
+		if !ok {
+			s = &span{}
+			spans[k] = s
+		}
+		switch rec.Phase {
+		case sectiontrace.Begin:
+			s.begin = rec.TimestampMicros
+			s.opened = true
+		case sectiontrace.End:
+			s.end = rec.TimestampMicros
+			s.closed = true
+		}
+	}
+
+	var pairs []Pair
+	for _, rec := range recs {
+		if rec.Phase != sectiontrace.Begin {
+			continue
+		}
+		id, ok := rec.IntArg(sectiontrace.ArgRemoteParent)
+		if !ok {
+			continue
+		}
+		scope, _ := rec.StringArg(sectiontrace.ArgRemoteParentScope)
+		if scope == rec.Scope {
+			continue
+		}
+		client, ok := spans[key{scope, id}]
+		server := spans[key{rec.Scope, rec.ID}]
+		if !ok || !client.opened || !client.closed || !server.opened || !server.closed {
+			continue
+		}
+		pairs = append(pairs, Pair{
+			ClientScope: scope,
+			ClientID:    id,
+			ServerScope: rec.Scope,
+			ServerID:    rec.ID,
+			Lo:          time.Duration(client.begin-server.begin) * time.Microsecond,
+			Hi:          time.Duration(client.end-server.end) * time.Microsecond,
+		})
+	}
+	return pairs
+}
+
+type edge struct {
+	client, server string
+}
+
+type edgeEstimate struct {
+	offset time.Duration
+	lo, hi time.Duration
+	pairs  int
+}
+
+// estimateEdge combines the pairs between two scopes. If all pairs are
+// consistent, the estimate is the median of their midpoints clamped to
+// the intersection of their ranges. Otherwise, pairs whose range
+// excludes the median are dropped as inconsistent.
+func estimateEdge(pairs []Pair) (edgeEstimate, []Pair) {
+	var usable, bad []Pair
+	for _, p := range pairs {
+		if p.Lo > p.Hi {
+			bad = append(bad, p)
+		} else {
+			usable = append(usable, p)
+		}
+	}
+	if len(usable) == 0 {
+		// Nothing better to go on than the impossible pairs themselves.
+		usable, bad = bad, nil
+	}
+
+	mids := make([]time.Duration, len(usable))
+	for i, p := range usable {
+		mids[i] = p.midpoint()
+	}
+	sort.Slice(mids, func(i, j int) bool { return mids[i] < mids[j] })
+	median := mids[len(mids)/2]
+	if len(mids)%2 == 0 {
+		median = mids[len(mids)/2-1] + (mids[len(mids)/2]-mids[len(mids)/2-1])/2
+	}
+
+	lo, hi := usable[0].Lo, usable[0].Hi
+	for _, p := range usable[1:] {
+		if p.Lo > lo {
+			lo = p.Lo
+		}
+		if p.Hi < hi {
+			hi = p.Hi
+		}
+	}
+
+	if lo > hi {
+		var kept []Pair
+		for _, p := range usable {
+			if p.Lo <= median && median <= p.Hi {
+				kept = append(kept, p)
+			} else {
+				bad = append(bad, p)
+			}
+		}
+		if len(kept) == 0 {
+			return edgeEstimate{offset: median, lo: median, hi: median, pairs: 0}, bad
+		}
+		usable = kept
+		lo, hi = usable[0].Lo, usable[0].Hi
+		for _, p := range usable[1:] {
+			if p.Lo > lo {
+				lo = p.Lo
+			}
+			if p.Hi < hi {
+				hi = p.Hi
+			}
+		}
+	}
+
+	offset := median
+	if offset < lo {
+		offset = lo
+	}
+	if offset > hi {
+		offset = hi
+	}
+	return edgeEstimate{offset: offset, lo: lo, hi: hi, pairs: len(usable)}, bad
+}
+
+// Estimate computes per-scope clock offsets. Scopes linked directly or
+// indirectly share a reference scope, chosen among scopes that have no
+// remote parents; unlinked scopes are their own reference.
+func Estimate(recs []*sectiontrace.Record) *Result {
+	result := &Result{Offsets: map[string]*Offset{}}
+
+	byEdge := map[edge][]Pair{}
+	for _, p := range Pairs(recs) {
+		e := edge{p.ClientScope, p.ServerScope}
+		byEdge[e] = append(byEdge[e], p)
+	}
+
+	estimates := map[edge]edgeEstimate{}
+	var edges []edge
+	for e, pairs := range byEdge {
+		est, bad := estimateEdge(pairs)
+		estimates[e] = est
+		edges = append(edges, e)
+		result.Inconsistent = append(result.Inconsistent, bad...)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].client != edges[j].client {
+			return edges[i].client < edges[j].client
+		}
+		return edges[i].server < edges[j].server
+	})
+	sort.Slice(result.Inconsistent, func(i, j int) bool {
+		a, b := result.Inconsistent[i], result.Inconsistent[j]
+		if a.ServerScope != b.ServerScope {
+			return a.ServerScope < b.ServerScope
+		}
+		return a.ServerID < b.ServerID
+	})
+
+	scopeSet := map[string]bool{}
+	isServer := map[string]bool{}
+	for _, rec := range recs {
+		scopeSet[rec.Scope] = true
+	}
+	for _, e := range edges {
+		scopeSet[e.client] = true
+		isServer[e.server] = true
+	}
+	var scopes []string
+	for s := range scopeSet {
+		scopes = append(scopes, s)
+	}
+	// Prefer starting from scopes that are never servers.
+	sort.Slice(scopes, func(i, j int) bool {
+		if isServer[scopes[i]] != isServer[scopes[j]] {
+			return !isServer[scopes[i]]
+		}
+		return scopes[i] < scopes[j]
+	})
+
+	for _, ref := range scopes {
+		if _, done := result.Offsets[ref]; done {
+			continue
+		}
+		result.Offsets[ref] = &Offset{Scope: ref, Reference: ref}
+		queue := []string{ref}
+		for len(queue) > 0 {
+			cur := result.Offsets[queue[0]]
+			queue = queue[1:]
+			for _, e := range edges {
+				est := estimates[e]
+				var next *Offset
+				switch {
+				case e.client == cur.Scope && result.Offsets[e.server] == nil:
+					next = &Offset{
+						Scope:  e.server,
+						Offset: cur.Offset + est.offset,
+						Lo:     cur.Lo + est.lo,
+						Hi:     cur.Hi + est.hi,
+					}
+				case e.server == cur.Scope && result.Offsets[e.client] == nil:
+					next = &Offset{
+						Scope:  e.client,
+						Offset: cur.Offset - est.offset,
+						Lo:     cur.Lo - est.hi,
+						Hi:     cur.Hi - est.lo,
+					}
+				default:
+					continue
+				}
+				next.Reference = ref
+				next.Pairs = est.pairs
+				result.Offsets[next.Scope] = next
+				queue = append(queue, next.Scope)
+			}
+		}
+	}
+
+	return result
+}
+
+// Apply corrects the timestamps of records in place.
+func (r *Result) Apply(recs []*sectiontrace.Record) {
+	for _, rec := range recs {
+		if o, ok := r.Offsets[rec.Scope]; ok {
+			rec.TimestampMicros += o.Offset.Microseconds()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package skew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func rec(name, scope string, id int32, phase sectiontrace.Phase, ts int64, args map[string]interface{}) *sectiontrace.Record {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return &sectiontrace.Record{Name: name, Scope: scope, ID: id, Phase: phase, TimestampMicros: ts, Args: args}
+}
+
+func remote(scope string, id int32) map[string]interface{} {
+	return map[string]interface{}{"rp": id, "rps": scope}
+}
+
+// call adds a client section [cb, ce] in scope "client" and a server
+// section [sb, se] in scope "server" started from it.
+func call(recs []*sectiontrace.Record, id int32, cb, ce, sb, se int64) []*sectiontrace.Record {
+	return append(recs,
+		rec("call", "client", id, sectiontrace.Begin, cb, nil),
+		rec("serve", "server", id, sectiontrace.Begin, sb, remote("client", id)),
+		rec("serve", "server", id, sectiontrace.End, se, remote("client", id)),
+		rec("call", "client", id, sectiontrace.End, ce, nil),
+	)
+}
+
+func TestEstimate(t *testing.T) {
+	// The server's clock is 5ms ahead, with 100µs network delay each way.
+	var recs []*sectiontrace.Record
+	recs = call(recs, 1, 1000, 2000, 6100, 6900)
+	recs = call(recs, 2, 3000, 3500, 8100, 8400)
+	recs = call(recs, 3, 4000, 4300, 9100, 9200)
+
+	result := Estimate(recs)
+	if len(result.Inconsistent) != 0 {
+		t.Errorf("inconsistent pairs: %+v", result.Inconsistent)
+	}
+	if o := result.Offsets["client"]; o == nil || o.Reference != "client" || o.Offset != 0 {
+		t.Errorf("client offset = %+v", o)
+	}
+	o := result.Offsets["server"]
+	if o == nil || o.Reference != "client" || o.Pairs != 3 {
+		t.Fatalf("server offset = %+v", o)
+	}
+	if got, want := o.Offset, -5*time.Millisecond; got != want {
+		t.Errorf("offset = %v want %v", got, want)
+	}
+	if o.Lo > o.Offset || o.Offset > o.Hi || o.Hi-o.Lo > 200*time.Microsecond {
+		t.Errorf("interval [%v, %v] for offset %v", o.Lo, o.Hi, o.Offset)
+	}
+
+	result.Apply(recs)
+	if recs[1].TimestampMicros < recs[0].TimestampMicros || recs[2].TimestampMicros > recs[3].TimestampMicros {
+		t.Errorf("server not within client after correction: %d..%d in %d..%d",
+			recs[1].TimestampMicros, recs[2].TimestampMicros, recs[0].TimestampMicros, recs[3].TimestampMicros)
+	}
+}
+
+func TestInconsistent(t *testing.T) {
+	var recs []*sectiontrace.Record
+	recs = call(recs, 1, 1000, 2000, 6100, 6900)
+	recs = call(recs, 2, 3000, 3500, 8100, 8400)
+	// Disagrees with the other pairs about the offset.
+	recs = call(recs, 3, 4000, 4300, 7000, 7100)
+	// Server section longer than its client.
+	recs = call(recs, 4, 5000, 5100, 10000, 10500)
+
+	result := Estimate(recs)
+	if len(result.Inconsistent) != 2 {
+		t.Fatalf("inconsistent = %+v", result.Inconsistent)
+	}
+	if result.Inconsistent[0].ServerID != 3 || result.Inconsistent[1].ServerID != 4 {
+		t.Errorf("inconsistent = %+v", result.Inconsistent)
+	}
+	o := result.Offsets["server"]
+	if o.Pairs != 2 || o.Lo > -5*time.Millisecond || o.Hi < -5*time.Millisecond {
+		t.Errorf("server offset = %+v", o)
+	}
+}
@@ -0,0 +1,147 @@
+package stats
+
+import (
+	"math/bits"
+	"time"
+)
+
+// subBucketBits controls the precision of the histogram: each power of
+// two is split into 2^(subBucketBits-1) buckets, giving a relative error
+// below 1%.
+const subBucketBits = 7
+
+const (
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram is a log-linear histogram of durations in the style of
+// HdrHistogram. Values are stored with microsecond resolution.
+// Histograms with the same layout can be merged exactly.
+type Histogram struct {
+	counts []int64
+	count  int64
+	min    int64
+	max    int64
+}
+
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	return shift*subBucketHalf + int(v>>uint(shift))
+}
+
+// bucketRange returns the lowest and highest values in a bucket.
+func bucketRange(idx int) (int64, int64) {
+	if idx < subBucketCount {
+		return int64(idx), int64(idx)
+	}
+	shift := idx/subBucketHalf - 1
+	mantissa := int64(idx - shift*subBucketHalf)
+	return mantissa << uint(shift), (mantissa+1)<<uint(shift) - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := d.Microseconds()
+	if v < 0 {
+		v = 0
+	}
+	idx := bucketIndex(v)
+	if idx >= len(h.counts) {
+		grown := make([]int64, idx+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[idx]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		grown := make([]int64, len(other.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+}
+
+func (h *Histogram) Copy() *Histogram {
+	rv := *h
+	rv.counts = append([]int64(nil), h.counts...)
+	return &rv
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min) * time.Microsecond
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Quantile returns an estimate of the q-quantile (0 <= q <= 1) of the
+// recorded values.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.Min()
+	}
+	if q >= 1 {
+		return h.Max()
+	}
+	rank := int64(q*float64(h.count-1)) + 1
+	seen := int64(0)
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			lo, hi := bucketRange(idx)
+			v := lo + (hi-lo)/2
+			if v < h.min {
+				v = h.min
+			}
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// Buckets calls fn for each non-empty bucket with the bucket's value
+// range and count, in increasing order.
+func (h *Histogram) Buckets(fn func(lo, hi time.Duration, count int64)) {
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lo, hi := bucketRange(idx)
+		fn(time.Duration(lo)*time.Microsecond, time.Duration(hi)*time.Microsecond, c)
+	}
+}
@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type jsonStats struct {
+	Name        string `json:"name"`
+	Count       int64  `json:"count"`
+	Errors      int64  `json:"errors"`
+	TotalMicros int64  `json:"total_us"`
+	SelfMicros  int64  `json:"self_us"`
+	MeanMicros  int64  `json:"mean_us"`
+	MinMicros   int64  `json:"min_us"`
+	P50Micros   int64  `json:"p50_us"`
+	P90Micros   int64  `json:"p90_us"`
+	P99Micros   int64  `json:"p99_us"`
+	MaxMicros   int64  `json:"max_us"`
+}
+
+func byTotal(stats []*Stats) []*Stats {
+	rv := append([]*Stats(nil), stats...)
+	sort.SliceStable(rv, func(i, j int) bool {
+		return rv[i].Total > rv[j].Total
+	})
+	return rv
+}
+
+// WriteJSON writes the statistics as a JSON array, sorted by total time.
+func WriteJSON(w io.Writer, stats []*Stats) error {
+	out := []jsonStats{}
+	for _, s := range byTotal(stats) {
+		out = append(out, jsonStats{
+			Name:        s.Name,
+			Count:       s.Count,
+			Errors:      s.Errors,
+			TotalMicros: s.Total.Microseconds(),
+			SelfMicros:  s.Self.Microseconds(),
+			MeanMicros:  s.Mean().Microseconds(),
+			MinMicros:   s.Duration.Min().Microseconds(),
+			P50Micros:   s.Duration.Quantile(0.5).Microseconds(),
+			P90Micros:   s.Duration.Quantile(0.9).Microseconds(),
+			P99Micros:   s.Duration.Quantile(0.99).Microseconds(),
+			MaxMicros:   s.Duration.Max().Microseconds(),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteText writes the statistics as a table, sorted by total time.
+func WriteText(w io.Writer, stats []*Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "count\terrors\ttotal\tself\tmean\tp50\tp99\tmax\t  name\n")
+	for _, s := range byTotal(stats) {
+		fmt.Fprintf(tw, "%d\t%d\t%v\t%v\t%v\t%v\t%v\t%v\t  %s\n",
+			s.Count, s.Errors,
+			round(s.Total), round(s.Self), round(s.Mean()),
+			round(s.Duration.Quantile(0.5)),
+			round(s.Duration.Quantile(0.99)),
+			round(s.Duration.Max()),
+			s.Name)
+	}
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d
+}
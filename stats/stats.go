@@ -0,0 +1,194 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+// Stats are the aggregate statistics for all sections with one name.
+type Stats struct {
+	Name     string
+	Count    int64
+	Errors   int64
+	Total    time.Duration
+	Self     time.Duration
+	Duration *Histogram
+}
+
+func newStats(name string) *Stats {
+	return &Stats{Name: name, Duration: &Histogram{}}
+}
+
+func (s *Stats) Copy() *Stats {
+	rv := *s
+	rv.Duration = s.Duration.Copy()
+	return &rv
+}
+
+func (s *Stats) Merge(other *Stats) {
+	s.Count += other.Count
+	s.Errors += other.Errors
+	s.Total += other.Total
+	s.Self += other.Self
+	s.Duration.Merge(other.Duration)
+}
+
+func (s *Stats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+type sectionKey struct {
+	scope string
+	id    int32
+}
+
+// Aggregator is a sectiontrace.Sink that maintains per-name statistics
+// as sections end.
+//
+// Self time is computed by subtracting the durations of children from
+// their parent. Children that run concurrently can make the sum exceed
+// the parent's duration; self time is then clamped to zero. Only the
+// children of sections that are still open count, so children that
+// outlive their parent, and those of sections that began before the
+// aggregator was installed, are not subtracted.
+type Aggregator struct {
+	mu     sync.Mutex
+	byName map[string]*Stats
+
+	// childTime holds the time spent in children of open sections.
+	childTime map[sectionKey]int64
+}
+
+// maxOpenSections bounds the number of open sections the aggregator
+// keeps track of, so that sections that never end cannot make it grow
+// without bound. Sections beyond it are counted in their parents' self
+// time.
+const maxOpenSections = 1 << 16
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		byName:    map[string]*Stats{},
+		childTime: map[sectionKey]int64{},
+	}
+}
+
+func (a *Aggregator) OnBegin(begin *sectiontrace.Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.childTime) < maxOpenSections {
+		a.childTime[sectionKey{scope: begin.Scope, id: begin.ID}] = 0
+	}
+}
+
+func (a *Aggregator) OnEnd(begin, end *sectiontrace.Record) {
+	micros := end.TimestampMicros - begin.TimestampMicros
+	ok, _ := end.BoolArg(sectiontrace.ArgOK)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	self := sectionKey{scope: end.Scope, id: end.ID}
+	selfMicros := micros - a.childTime[self]
+	delete(a.childTime, self)
+	if selfMicros < 0 {
+		selfMicros = 0
+	}
+
+	if parentID, hasParent := end.IntArg(sectiontrace.ArgParent); hasParent {
+		parent := sectionKey{scope: end.Scope, id: parentID}
+		if _, open := a.childTime[parent]; open {
+			a.childTime[parent] += micros
+		}
+	}
+
+	a.addLocked(end.Name, time.Duration(micros)*time.Microsecond, time.Duration(selfMicros)*time.Microsecond, ok)
+}
+
+func (a *Aggregator) addLocked(name string, total, self time.Duration, ok bool) {
+	s, present := a.byName[name]
+	if !present {
+		s = newStats(name)
+		a.byName[name] = s
+	}
+	s.Count++
+	if !ok {
+		s.Errors++
+	}
+	s.Total += total
+	s.Self += self
+	s.Duration.Record(total)
+}
+
+// Snapshot returns a copy of the current statistics, sorted by name.
+func (a *Aggregator) Snapshot() []*Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rv := make([]*Stats, 0, len(a.byName))
+	for _, s := range a.byName {
+		rv = append(rv, s.Copy())
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+func (a *Aggregator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.byName = map[string]*Stats{}
+	a.childTime = map[sectionKey]int64{}
+}
+
+// Merge combines snapshots, e.g. from several processes.
+func Merge(snapshots ...[]*Stats) []*Stats {
+	byName := map[string]*Stats{}
+	for _, snapshot := range snapshots {
+		for _, s := range snapshot {
+			if existing, ok := byName[s.Name]; ok {
+				existing.Merge(s)
+			} else {
+				byName[s.Name] = s.Copy()
+			}
+		}
+	}
+	rv := make([]*Stats, 0, len(byName))
+	for _, s := range byName {
+		rv = append(rv, s)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Name < rv[j].Name
+	})
+	return rv
+}
+
+// AddTree adds the closed sections of a reconstructed tree. Since the
+// whole tree is known, self time is exact even for concurrent children.
+func (a *Aggregator) AddTree(t *tree.Tree) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t.Walk(func(n *tree.Node) bool {
+		if n.Closed() {
+			a.addLocked(n.Name, n.Duration(), n.SelfTime(), n.OK())
+		}
+		return true
+	})
+}
+
+// FromRecords computes statistics for a set of records.
+func FromRecords(recs []*sectiontrace.Record) []*Stats {
+	agg := NewAggregator()
+	agg.AddTree(tree.Build(recs))
+	return agg.Snapshot()
+}
@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := time.Duration(q*10000) * time.Millisecond
+		got := h.Quantile(q)
+		if diff := got - want; diff > want/100 || diff < -want/100 {
+			t.Errorf("Quantile(%v) = %v want ~%v", q, got, want)
+		}
+	}
+	if h.Min() != time.Millisecond || h.Max() != 10*time.Second {
+		t.Errorf("min/max = %v/%v", h.Min(), h.Max())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, both := &Histogram{}, &Histogram{}, &Histogram{}
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(i*i) * time.Microsecond
+		if i%2 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+		both.Record(d)
+	}
+	a.Merge(b)
+	for _, q := range []float64{0, 0.1, 0.5, 0.99, 1} {
+		if a.Quantile(q) != both.Quantile(q) {
+			t.Errorf("Quantile(%v) = %v want %v", q, a.Quantile(q), both.Quantile(q))
+		}
+	}
+	if a.Count() != 1000 {
+		t.Errorf("Count() = %d", a.Count())
+	}
+}
+
+func pair(name string, id, parent int32, t0, t1 int64, ok bool) (*sectiontrace.Record, *sectiontrace.Record) {
+	begin := &sectiontrace.Record{Name: name, ID: id, Phase: sectiontrace.Begin, TimestampMicros: t0, Args: map[string]interface{}{}}
+	end := &sectiontrace.Record{Name: name, ID: id, Phase: sectiontrace.End, TimestampMicros: t1, Args: map[string]interface{}{"ok": ok}}
+	if parent != 0 {
+		begin.Args["p"] = parent
+		end.Args["p"] = parent
+	}
+	return begin, end
+}
+
+// feed passes the sections to agg, beginning all of them before ending
+// them in order.
+func feed(agg *Aggregator, pairs ...[2]*sectiontrace.Record) {
+	for _, p := range pairs {
+		agg.OnBegin(p[0])
+	}
+	for _, p := range pairs {
+		agg.OnEnd(p[0], p[1])
+	}
+}
+
+func section(name string, id, parent int32, t0, t1 int64, ok bool) [2]*sectiontrace.Record {
+	begin, end := pair(name, id, parent, t0, t1, ok)
+	return [2]*sectiontrace.Record{begin, end}
+}
+
+func TestAggregator(t *testing.T) {
+	agg := NewAggregator()
+	feed(agg,
+		section("child", 2, 1, 100, 400, true),
+		section("child", 3, 1, 500, 600, false),
+		section("root", 1, 0, 0, 1000, true))
+
+	snapshot := agg.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("got %d stats", len(snapshot))
+	}
+	child, root := snapshot[0], snapshot[1]
+	if child.Count != 2 || child.Errors != 1 || child.Total != 400*time.Microsecond {
+		t.Errorf("child stats = %+v", child)
+	}
+	if root.Self != 600*time.Microsecond {
+		t.Errorf("root self time = %v", root.Self)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[1], "root") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
+
+func TestAggregatorForgetsEndedSections(t *testing.T) {
+	agg := NewAggregator()
+	// The child outlives its parent, and its grandchild begins after
+	// the parent has ended.
+	feed(agg,
+		section("parent", 1, 0, 0, 100, true),
+		section("child", 2, 1, 50, 500, true))
+	feed(agg, section("grandchild", 3, 2, 600, 700, true))
+
+	agg.mu.Lock()
+	open := len(agg.childTime)
+	agg.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d sections still tracked after all ended", open)
+	}
+	for _, s := range agg.Snapshot() {
+		if s.Name == "parent" && s.Self != 100*time.Microsecond {
+			t.Errorf("parent self time = %v", s.Self)
+		}
+	}
+}
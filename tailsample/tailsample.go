@@ -0,0 +1,286 @@
+// Package tailsample provides a sink that decides whether to keep a
+// trace only once its root section has ended, so that slow or failed
+// requests can be kept in full while the rest are dropped.
+package tailsample
+
+import (
+	"sync"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+var (
+	DefaultMaxRecords = 100000
+	DefaultMaxDecided = 10000
+)
+
+// OverflowPolicy decides what happens to the oldest buffered trace when
+// the buffer is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest drops the oldest trace, including any of its records
+	// that arrive later.
+	DropOldest OverflowPolicy = iota
+	// KeepOldest passes the oldest trace on as though it had been
+	// kept, including any of its records that arrive later.
+	KeepOldest
+)
+
+type key struct {
+	scope string
+	id    int32
+}
+
+// event is a buffered call to OnBegin (if end is nil) or OnEnd.
+type event struct {
+	begin, end *sectiontrace.Record
+}
+
+type trace struct {
+	events  []event
+	failed  bool
+	matched bool
+}
+
+// Sampler is a sectiontrace.Sink that buffers records per root section
+// until the root ends, then passes the whole tree on to Next if any of
+// the configured conditions hold, and drops it otherwise. It is safe for
+// concurrent use.
+//
+// Records for sections that end after their root (e.g. in goroutines
+// that outlive it) follow the decision made for the root, as long as it
+// is among the last MaxDecided decisions. Records of traces whose root
+// began before the Sampler was installed are passed on unconditionally.
+//
+// Next is called with the Sampler's lock held, so that it receives the
+// records of each section in order, even when a late record arrives
+// while the trace's buffered records are being passed on.
+type Sampler struct {
+	Next sectiontrace.Sink
+
+	// MinDuration keeps traces whose root took at least this long.
+	// Zero disables the condition.
+	MinDuration time.Duration
+	// KeepFailed keeps traces in which any section failed.
+	KeepFailed bool
+	// Names keeps traces containing any section with one of these names.
+	Names map[string]bool
+	// Keep, if set, is called with the records of each trace not kept
+	// by the other conditions.
+	Keep func(recs []*sectiontrace.Record) bool
+
+	// MaxRecords bounds the number of records buffered across all
+	// traces; when it is exceeded, the oldest trace is handled according
+	// to Overflow.
+	MaxRecords int
+	Overflow   OverflowPolicy
+	// MaxDecided bounds the number of decisions remembered for late
+	// records.
+	MaxDecided int
+
+	mu       sync.Mutex
+	pending  map[key]*trace
+	order    []key
+	buffered int
+	decided  map[key]bool
+	ring     []key
+	ringNext int
+
+	kept, dropped, overflowed int64
+}
+
+func New(next sectiontrace.Sink) *Sampler {
+	return &Sampler{
+		Next:       next,
+		MaxRecords: DefaultMaxRecords,
+		MaxDecided: DefaultMaxDecided,
+		pending:    map[key]*trace{},
+		decided:    map[key]bool{},
+	}
+}
+
+// Stats returns the number of traces kept, dropped, and handled early
+// because the buffer overflowed.
+func (s *Sampler) Stats() (kept, dropped, overflowed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kept, s.dropped, s.overflowed
+}
+
+// rootKey identifies the root section of the trace a record belongs to.
+// Detached sections belong to the trace of the section they follow from.
+func rootKey(rec *sectiontrace.Record) (key, bool) {
+	_, hasParent := rec.IntArg(sectiontrace.ArgParent)
+	_, detached := rec.IntArg(sectiontrace.ArgFollowsFrom)
+	ancestor, hasAncestor := rec.IntArg(sectiontrace.ArgAncestor)
+	if !hasParent && !(detached && hasAncestor) {
+		return key{rec.Scope, rec.ID}, true
+	}
+	return key{rec.Scope, ancestor}, false
+}
+
+func (s *Sampler) OnBegin(begin *sectiontrace.Record) {
+	s.add(event{begin: begin})
+}
+
+func (s *Sampler) OnEnd(begin, end *sectiontrace.Record) {
+	s.add(event{begin: begin, end: end})
+}
+
+func (s *Sampler) add(ev event) {
+	rec := ev.begin
+	if ev.end != nil {
+		rec = ev.end
+	}
+	k, isRoot := rootKey(rec)
+
+	var forward []event
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.pending[k]
+	switch {
+	case ok:
+		s.buffer(t, ev)
+		if isRoot && ev.end != nil {
+			forward = s.decideLocked(k, t, s.shouldKeep(t, ev.begin, ev.end))
+		}
+	case isRoot && ev.end == nil:
+		if _, decided := s.decided[k]; decided {
+			// A repeated begin record; treat it as late.
+			if s.decided[k] {
+				forward = []event{ev}
+			}
+			break
+		}
+		t = &trace{}
+		s.pending[k] = t
+		s.order = append(s.order, k)
+		s.buffer(t, ev)
+	default:
+		if keep, decided := s.decided[k]; !decided || keep {
+			forward = []event{ev}
+		}
+	}
+	forward = append(forward, s.overflowLocked()...)
+	s.sendLocked(forward)
+}
+
+func (s *Sampler) buffer(t *trace, ev event) {
+	t.events = append(t.events, ev)
+	s.buffered++
+	if ev.end != nil {
+		if ok, present := ev.end.BoolArg(sectiontrace.ArgOK); present && !ok {
+			t.failed = true
+		}
+	}
+	if s.Names[ev.begin.Name] {
+		t.matched = true
+	}
+}
+
+func (s *Sampler) shouldKeep(t *trace, begin, end *sectiontrace.Record) bool {
+	if s.MinDuration > 0 && time.Duration(end.TimestampMicros-begin.TimestampMicros)*time.Microsecond >= s.MinDuration {
+		return true
+	}
+	if (s.KeepFailed && t.failed) || t.matched {
+		return true
+	}
+	if s.Keep != nil {
+		recs := make([]*sectiontrace.Record, len(t.events))
+		for i, ev := range t.events {
+			recs[i] = ev.begin
+			if ev.end != nil {
+				recs[i] = ev.end
+			}
+		}
+		return s.Keep(recs)
+	}
+	return false
+}
+
+// decideLocked removes a trace from the buffer, remembers the decision,
+// and returns the events to pass on.
+func (s *Sampler) decideLocked(k key, t *trace, keep bool) []event {
+	delete(s.pending, k)
+	s.buffered -= len(t.events)
+
+	if s.MaxDecided > 0 {
+		if len(s.ring) < s.MaxDecided {
+			s.ring = append(s.ring, k)
+		} else {
+			delete(s.decided, s.ring[s.ringNext])
+			s.ring[s.ringNext] = k
+			s.ringNext = (s.ringNext + 1) % len(s.ring)
+		}
+		s.decided[k] = keep
+	}
+
+	if !keep {
+		s.dropped++
+		return nil
+	}
+	s.kept++
+	return t.events
+}
+
+func (s *Sampler) overflowLocked() []event {
+	var rv []event
+	for s.MaxRecords > 0 && s.buffered > s.MaxRecords && len(s.order) > 0 {
+		k := s.order[0]
+		s.order = s.order[1:]
+		t, ok := s.pending[k]
+		if !ok {
+			continue
+		}
+		s.overflowed++
+		rv = append(rv, s.decideLocked(k, t, s.Overflow == KeepOldest)...)
+	}
+	// Compact the order, which also holds keys of decided traces.
+	if len(s.order) > 2*len(s.pending)+16 {
+		order := make([]key, 0, len(s.pending))
+		for _, k := range s.order {
+			if _, ok := s.pending[k]; ok {
+				order = append(order, k)
+			}
+		}
+		s.order = order
+	}
+	return rv
+}
+
+func (s *Sampler) sendLocked(events []event) {
+	for _, ev := range events {
+		if ev.end == nil {
+			s.Next.OnBegin(ev.begin)
+		} else {
+			s.Next.OnEnd(ev.begin, ev.end)
+		}
+	}
+}
+
+// Flush decides all buffered traces as though their roots had ended
+// with the last record received for them, e.g. before exiting.
+func (s *Sampler) Flush() {
+	var forward []event
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.order {
+		t, ok := s.pending[k]
+		if !ok {
+			continue
+		}
+		first, last := t.events[0].begin, t.events[len(t.events)-1].begin
+		if end := t.events[len(t.events)-1].end; end != nil {
+			last = end
+		}
+		forward = append(forward, s.decideLocked(k, t, s.shouldKeep(t, first, last))...)
+	}
+	s.order = nil
+	s.sendLocked(forward)
+}
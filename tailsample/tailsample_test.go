@@ -0,0 +1,193 @@
+package tailsample
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+type collector struct {
+	recs []*sectiontrace.Record
+}
+
+func (c *collector) OnBegin(begin *sectiontrace.Record) {
+	c.recs = append(c.recs, begin)
+}
+
+func (c *collector) OnEnd(begin, end *sectiontrace.Record) {
+	c.recs = append(c.recs, end)
+}
+
+func (c *collector) ids() map[int32]int {
+	rv := map[int32]int{}
+	for _, rec := range c.recs {
+		rv[rec.ID]++
+	}
+	return rv
+}
+
+func begin(name string, id, root int32, ts int64) *sectiontrace.Record {
+	args := map[string]interface{}{}
+	if root != id {
+		args["p"] = root
+		args["a"] = root
+	}
+	return &sectiontrace.Record{Name: name, ID: id, Phase: sectiontrace.Begin, TimestampMicros: ts, Args: args}
+}
+
+func end(b *sectiontrace.Record, ts int64, ok bool) *sectiontrace.Record {
+	rv := *b
+	rv.Phase = sectiontrace.End
+	rv.TimestampMicros = ts
+	rv.Args = map[string]interface{}{"ok": ok}
+	for k, v := range b.Args {
+		rv.Args[k] = v
+	}
+	return &rv
+}
+
+// request runs a root with one child through the sink.
+func request(s sectiontrace.Sink, root int32, ts, dur int64, childOK bool) {
+	r := begin("request", root, root, ts)
+	c := begin("query", root+1, root, ts+1)
+	s.OnBegin(r)
+	s.OnBegin(c)
+	s.OnEnd(c, end(c, ts+dur-1, childOK))
+	s.OnEnd(r, end(r, ts+dur, true))
+}
+
+func TestSampler(t *testing.T) {
+	out := &collector{}
+	s := New(out)
+	s.MinDuration = time.Millisecond
+	s.KeepFailed = true
+
+	request(s, 10, 0, 100, true)  // fast: dropped
+	request(s, 20, 0, 5000, true) // slow: kept
+	request(s, 30, 0, 100, false) // failed: kept
+	request(s, 40, 0, 100, true)  // fast: dropped
+
+	ids := out.ids()
+	if len(out.recs) != 8 || ids[20] != 2 || ids[21] != 2 || ids[30] != 2 || ids[31] != 2 {
+		t.Errorf("got ids %v", ids)
+	}
+	if kept, dropped, overflowed := s.Stats(); kept != 2 || dropped != 2 || overflowed != 0 {
+		t.Errorf("stats = %d, %d, %d", kept, dropped, overflowed)
+	}
+
+	// A section outliving its dropped root is dropped too, and one
+	// outliving a kept root is passed on.
+	late := begin("late", 12, 10, 200)
+	s.OnEnd(late, end(late, 300, true))
+	late = begin("late", 22, 20, 200)
+	s.OnEnd(late, end(late, 6000, true))
+	if len(out.recs) != 9 || out.recs[8].ID != 22 {
+		t.Errorf("late records: %v", out.ids())
+	}
+
+	// Detached sections share the fate of the trace they follow from.
+	for _, root := range []int32{10, 20} {
+		detached := &sectiontrace.Record{Name: "refresh", ID: root + 5, Phase: sectiontrace.Begin, TimestampMicros: 400,
+			Args: map[string]interface{}{"f": root, "a": root}}
+		s.OnEnd(detached, end(detached, 500, true))
+	}
+	if len(out.recs) != 10 || out.recs[9].ID != 25 {
+		t.Errorf("detached records: %v", out.ids())
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{DropOldest, KeepOldest} {
+		out := &collector{}
+		s := New(out)
+		s.Names = map[string]bool{"never": true}
+		s.MaxRecords = 4
+		s.Overflow = policy
+
+		// Three unfinished traces of two records each.
+		for _, root := range []int32{10, 20, 30} {
+			s.OnBegin(begin("request", root, root, 0))
+			s.OnBegin(begin("query", root+1, root, 1))
+		}
+		_, _, overflowed := s.Stats()
+		if overflowed != 1 {
+			t.Errorf("policy %d: overflowed = %d", policy, overflowed)
+		}
+
+		got := len(out.recs)
+		if policy == KeepOldest && (got != 2 || out.recs[0].ID != 10) {
+			t.Errorf("KeepOldest: got %v", out.ids())
+		}
+		if policy == DropOldest && got != 0 {
+			t.Errorf("DropOldest: got %v", out.ids())
+		}
+
+		s.Flush()
+		if len(out.recs) != got {
+			t.Errorf("policy %d: Flush kept traces matching no condition", policy)
+		}
+	}
+}
+
+// orderChecker fails the test if a section ends before it begins.
+type orderChecker struct {
+	t     *testing.T
+	mu    sync.Mutex
+	begun map[int32]bool
+}
+
+func (c *orderChecker) OnBegin(begin *sectiontrace.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.begun[begin.ID] = true
+}
+
+func (c *orderChecker) OnEnd(begin, end *sectiontrace.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.begun[end.ID] {
+		c.t.Errorf("section %d ended before it began", end.ID)
+	}
+}
+
+// stallingSink stalls while the begin record of section 1 is passed on.
+type stallingSink struct {
+	orderChecker
+	stalled chan struct{}
+}
+
+func (s *stallingSink) OnBegin(begin *sectiontrace.Record) {
+	if begin.ID == 1 {
+		close(s.stalled)
+		time.Sleep(20 * time.Millisecond)
+	}
+	s.orderChecker.OnBegin(begin)
+}
+
+func TestLateRecordsInOrder(t *testing.T) {
+	next := &stallingSink{
+		orderChecker: orderChecker{t: t, begun: map[int32]bool{}},
+		stalled:      make(chan struct{}),
+	}
+	s := New(next)
+	s.Names = map[string]bool{"request": true}
+
+	r := begin("request", 1, 1, 0)
+	c := begin("query", 2, 1, 1)
+	s.OnBegin(r)
+	s.OnBegin(c)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.OnEnd(r, end(r, 5, true))
+	}()
+
+	// The trace is kept, and its buffered records are being passed on,
+	// when the child's end arrives.
+	<-next.stalled
+	s.OnEnd(c, end(c, 10, true))
+	<-done
+}
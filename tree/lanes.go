@@ -0,0 +1,85 @@
+package tree
+
+import (
+	"math"
+	"sort"
+)
+
+// Lanes assigns the sections of each process to lanes, numbered from
+// zero per process ID. Within a lane, a section is only ever nested
+// directly inside its own parent, so each lane can be drawn as a single
+// row of nested slices even when sections run concurrently. Sections
+// are kept in their parent's lane where possible.
+func (t *Tree) Lanes() map[*Node]int {
+	byPID := map[int32][]*Node{}
+	t.Walk(func(n *Node) bool {
+		pid := n.record().ProcessID
+		byPID[pid] = append(byPID[pid], n)
+		return true
+	})
+
+	rv := map[*Node]int{}
+	for _, nodes := range byPID {
+		assignLanes(nodes, rv)
+	}
+	return rv
+}
+
+// laneEnd is the end used for packing; unclosed sections are treated as
+// never ending.
+func laneEnd(n *Node) int64 {
+	if n.End == nil {
+		return math.MaxInt64
+	}
+	return n.Finish()
+}
+
+func assignLanes(nodes []*Node, rv map[*Node]int) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Start() != nodes[j].Start() {
+			return nodes[i].Start() < nodes[j].Start()
+		}
+		if laneEnd(nodes[i]) != laneEnd(nodes[j]) {
+			return laneEnd(nodes[i]) > laneEnd(nodes[j])
+		}
+		return nodes[i].Depth < nodes[j].Depth
+	})
+
+	// Each lane is a stack of the currently open sections.
+	var lanes [][]*Node
+
+	fits := func(lane int, n *Node) bool {
+		stack := lanes[lane]
+		for len(stack) > 0 && laneEnd(stack[len(stack)-1]) <= n.Start() {
+			stack = stack[:len(stack)-1]
+		}
+		lanes[lane] = stack
+		if len(stack) == 0 {
+			return true
+		}
+		top := stack[len(stack)-1]
+		return top == n.Parent && laneEnd(top) >= laneEnd(n)
+	}
+
+	for _, n := range nodes {
+		lane := -1
+		if parentLane, ok := rv[n.Parent]; ok && sameProcess(n, n.Parent) && fits(parentLane, n) {
+			lane = parentLane
+		}
+		for i := 0; lane < 0 && i < len(lanes); i++ {
+			if fits(i, n) {
+				lane = i
+			}
+		}
+		if lane < 0 {
+			lane = len(lanes)
+			lanes = append(lanes, nil)
+		}
+		lanes[lane] = append(lanes[lane], n)
+		rv[n] = lane
+	}
+}
+
+func sameProcess(a, b *Node) bool {
+	return a != nil && b != nil && a.record().ProcessID == b.record().ProcessID
+}
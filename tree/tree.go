@@ -0,0 +1,290 @@
+package tree
+
+import (
+	"sort"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+// Key identifies a section within a trace.
+type Key struct {
+	Scope string
+	ID    int32
+}
+
+// Node is a single section, with its begin and end records paired up.
+type Node struct {
+	Key
+	Name  string
+	Begin *sectiontrace.Record
+	End   *sectiontrace.Record
+
+	// Parent is the enclosing section, if it is present in the trace.
+	// Remote is set when the parent was found through the remote parent
+	// args rather than the local ones.
+	Parent   *Node
+	Remote   bool
+	Children []*Node
+	Depth    int
+
+	// FollowsFrom is the section that started this one as detached
+	// background work, if it is present in the trace. Such sections are
+	// roots rather than children of the section they follow from.
+	FollowsFrom *Node
+
+	// Links are the sections this one links to that are present in the
+	// trace, in the order of the ArgLinks arg.
+	Links []*Node
+}
+
+// Tree is a reconstructed section tree.
+type Tree struct {
+	Nodes map[Key]*Node
+	Roots []*Node
+
+	// Orphans are sections that reference a parent missing from the
+	// trace. They are also included in Roots.
+	Orphans []*Node
+	// Unclosed sections have a begin record but no end record.
+	Unclosed []*Node
+	// Unopened sections have an end record but no begin record.
+	Unopened []*Node
+	// Duplicates are records that repeat the phase of an already-seen
+	// record for the same section. They are otherwise ignored.
+	Duplicates []*sectiontrace.Record
+}
+
+func FromSummary(summary *sectiontrace.Summary) *Tree {
+	return Build(summary.TraceEvents)
+}
+
+func Build(recs []*sectiontrace.Record) *Tree {
+	t := &Tree{
+		Nodes: map[Key]*Node{},
+	}
+
+	var order []*Node
+	for _, rec := range recs {
+		if rec.Phase != sectiontrace.Begin && rec.Phase != sectiontrace.End {
+			continue
+		}
+		k := Key{Scope: rec.Scope, ID: rec.ID}
+		n, ok := t.Nodes[k]
+		if !ok {
+			n = &Node{Key: k, Name: rec.Name}
+			t.Nodes[k] = n
+			order = append(order, n)
+		}
+		slot := &n.Begin
+		if rec.Phase == sectiontrace.End {
+			slot = &n.End
+		}
+		if *slot != nil {
+			t.Duplicates = append(t.Duplicates, rec)
+			continue
+		}
+		*slot = rec
+	}
+
+	for _, n := range order {
+		switch {
+		case n.Begin == nil:
+			t.Unopened = append(t.Unopened, n)
+		case n.End == nil:
+			t.Unclosed = append(t.Unclosed, n)
+		}
+
+		parentKey, remote, hasParent := n.parentKey()
+		if !hasParent {
+			t.Roots = append(t.Roots, n)
+			continue
+		}
+		parent, ok := t.Nodes[parentKey]
+		if !ok || parent == n {
+			t.Orphans = append(t.Orphans, n)
+			t.Roots = append(t.Roots, n)
+			continue
+		}
+		n.Parent = parent
+		n.Remote = remote
+		parent.Children = append(parent.Children, n)
+	}
+
+	for _, n := range order {
+		if id, ok := n.record().IntArg(sectiontrace.ArgFollowsFrom); ok {
+			if origin, ok := t.Nodes[Key{Scope: n.Scope, ID: id}]; ok && origin != n {
+				n.FollowsFrom = origin
+			}
+		}
+		for _, link := range n.record().Links() {
+			if target, ok := t.Nodes[Key{Scope: link.Section.Scope, ID: link.Section.ID}]; ok && target != n {
+				n.Links = append(n.Links, target)
+			}
+		}
+	}
+
+	sortNodes(t.Roots)
+	visited := map[*Node]bool{}
+	for _, root := range t.Roots {
+		setDepth(root, 0, visited)
+	}
+
+	// Anything not reachable from a root is part of a reference cycle;
+	// break the cycle and treat the node as an orphan.
+	for _, n := range order {
+		if visited[n] {
+			continue
+		}
+		removeChild(n.Parent, n)
+		n.Parent = nil
+		n.Remote = false
+		t.Orphans = append(t.Orphans, n)
+		t.Roots = append(t.Roots, n)
+		setDepth(n, 0, visited)
+	}
+
+	return t
+}
+
+func (n *Node) record() *sectiontrace.Record {
+	if n.Begin != nil {
+		return n.Begin
+	}
+	return n.End
+}
+
+func (n *Node) parentKey() (Key, bool, bool) {
+	for _, rec := range []*sectiontrace.Record{n.Begin, n.End} {
+		if rec == nil {
+			continue
+		}
+		if id, ok := rec.IntArg(sectiontrace.ArgParent); ok {
+			return Key{Scope: n.Scope, ID: id}, false, true
+		}
+		if id, ok := rec.IntArg(sectiontrace.ArgRemoteParent); ok {
+			scope, _ := rec.StringArg(sectiontrace.ArgRemoteParentScope)
+			return Key{Scope: scope, ID: id}, true, true
+		}
+	}
+	return Key{}, false, false
+}
+
+func setDepth(n *Node, depth int, visited map[*Node]bool) {
+	visited[n] = true
+	n.Depth = depth
+	sortNodes(n.Children)
+	for _, c := range n.Children {
+		setDepth(c, depth+1, visited)
+	}
+}
+
+func removeChild(parent, child *Node) {
+	if parent == nil {
+		return
+	}
+	for i, c := range parent.Children {
+		if c == child {
+			parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+			return
+		}
+	}
+}
+
+func sortNodes(nodes []*Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Start() != nodes[j].Start() {
+			return nodes[i].Start() < nodes[j].Start()
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+// Lookup returns the section with the given scope and ID, or nil.
+func (t *Tree) Lookup(scope string, id int32) *Node {
+	return t.Nodes[Key{Scope: scope, ID: id}]
+}
+
+// Walk visits every section in depth-first order, parents before their
+// children. Returning false from fn skips the children of that node.
+func (t *Tree) Walk(fn func(*Node) bool) {
+	for _, root := range t.Roots {
+		root.Walk(fn)
+	}
+}
+
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Closed reports whether both the begin and end records are present.
+func (n *Node) Closed() bool {
+	return n.Begin != nil && n.End != nil
+}
+
+// OK reports whether the section ended without an error.
+func (n *Node) OK() bool {
+	if n.End == nil {
+		return true
+	}
+	ok, present := n.End.BoolArg(sectiontrace.ArgOK)
+	return ok || !present
+}
+
+// Start returns the begin timestamp in microseconds.
+func (n *Node) Start() int64 {
+	return n.record().TimestampMicros
+}
+
+// Finish returns the end timestamp in microseconds. For unclosed
+// sections it is the same as Start.
+func (n *Node) Finish() int64 {
+	if n.End == nil {
+		return n.Start()
+	}
+	return n.End.TimestampMicros
+}
+
+func (n *Node) Duration() time.Duration {
+	return time.Duration(n.Finish()-n.Start()) * time.Microsecond
+}
+
+// SelfTime is the part of the section's duration not covered by any of
+// its children. Concurrent children are only counted once.
+func (n *Node) SelfTime() time.Duration {
+	start, finish := n.Start(), n.Finish()
+	covered := int64(0)
+	cursor := start
+	for _, c := range n.Children {
+		// Children are sorted by start time.
+		lo, hi := c.Start(), c.Finish()
+		if lo < cursor {
+			lo = cursor
+		}
+		if hi > finish {
+			hi = finish
+		}
+		if hi > lo {
+			covered += hi - lo
+			cursor = hi
+		}
+	}
+	return time.Duration(finish-start-covered) * time.Microsecond
+}
+
+// Path returns the names of the sections from the root down to n.
+func (n *Node) Path() []string {
+	var rv []string
+	for p := n; p != nil; p = p.Parent {
+		rv = append(rv, p.Name)
+	}
+	for i, j := 0, len(rv)-1; i < j; i, j = i+1, j-1 {
+		rv[i], rv[j] = rv[j], rv[i]
+	}
+	return rv
+}
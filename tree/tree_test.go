@@ -0,0 +1,183 @@
+package tree
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func rec(name string, id int32, phase sectiontrace.Phase, ts int64, args map[string]interface{}) *sectiontrace.Record {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return &sectiontrace.Record{
+		Name:            name,
+		ID:              id,
+		Phase:           phase,
+		Scope:           "s",
+		TimestampMicros: ts,
+		Args:            args,
+	}
+}
+
+func args(kv ...interface{}) map[string]interface{} {
+	rv := map[string]interface{}{}
+	for i := 0; i < len(kv); i += 2 {
+		rv[kv[i].(string)] = kv[i+1]
+	}
+	return rv
+}
+
+func testRecords() []*sectiontrace.Record {
+	return []*sectiontrace.Record{
+		rec("root", 1, sectiontrace.Begin, 0, nil),
+		rec("a", 2, sectiontrace.Begin, 10, args("p", int32(1), "a", int32(1))),
+		rec("b", 3, sectiontrace.Begin, 20, args("p", int32(1), "a", int32(1))),
+		rec("a", 2, sectiontrace.End, 50, args("p", int32(1), "a", int32(1), "ok", true)),
+		rec("b", 3, sectiontrace.End, 60, args("p", int32(1), "a", int32(1), "ok", false)),
+		rec("c", 4, sectiontrace.Begin, 70, args("p", int32(1), "a", int32(1))),
+		rec("root", 1, sectiontrace.End, 100, args("ok", true)),
+		rec("orphan", 5, sectiontrace.Begin, 10, args("p", int32(99), "a", int32(99))),
+		rec("orphan", 5, sectiontrace.End, 20, args("p", int32(99), "a", int32(99), "ok", true)),
+	}
+}
+
+func names(nodes []*Node) []string {
+	var rv []string
+	for _, n := range nodes {
+		rv = append(rv, n.Name)
+	}
+	return rv
+}
+
+func checkTree(t *testing.T, tr *Tree) {
+	if got, want := names(tr.Roots), []string{"root", "orphan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("roots = %v want %v", got, want)
+	}
+	if got, want := names(tr.Orphans), []string{"orphan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("orphans = %v want %v", got, want)
+	}
+	if got, want := names(tr.Unclosed), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unclosed = %v want %v", got, want)
+	}
+
+	root := tr.Lookup("s", 1)
+	if got, want := names(root.Children), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("children = %v want %v", got, want)
+	}
+	if got, want := root.Duration(), 100*time.Microsecond; got != want {
+		t.Errorf("duration = %v want %v", got, want)
+	}
+	// a and b overlap and cover [10, 60).
+	if got, want := root.SelfTime(), 50*time.Microsecond; got != want {
+		t.Errorf("self time = %v want %v", got, want)
+	}
+
+	b := tr.Lookup("s", 3)
+	if b.OK() {
+		t.Errorf("b.OK() = true")
+	}
+	if b.Depth != 1 {
+		t.Errorf("b.Depth = %d", b.Depth)
+	}
+	if got, want := b.Path(), []string{"root", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("path = %v want %v", got, want)
+	}
+
+	var walked []string
+	tr.Walk(func(n *Node) bool {
+		walked = append(walked, n.Name)
+		return true
+	})
+	if got, want := walked, []string{"root", "a", "b", "c", "orphan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("walk = %v want %v", got, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	checkTree(t, Build(testRecords()))
+}
+
+func TestBuildFromJSON(t *testing.T) {
+	data, err := json.Marshal(sectiontrace.Export(testRecords()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary sectiontrace.Summary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, FromSummary(&summary))
+}
+
+func TestRemoteParent(t *testing.T) {
+	recs := testRecords()
+	server := &sectiontrace.Record{
+		Name:            "server",
+		ID:              1,
+		Phase:           sectiontrace.Begin,
+		Scope:           "other",
+		TimestampMicros: 15,
+		Args:            args("rp", int32(2), "rps", "s", "ra", int32(1), "ras", "s"),
+	}
+	tr := Build(append(recs, server))
+
+	n := tr.Lookup("other", 1)
+	if n.Parent == nil || n.Parent.Name != "a" || !n.Remote {
+		t.Fatalf("remote parent not linked: %+v", n)
+	}
+	if n.Depth != 2 {
+		t.Errorf("depth = %d", n.Depth)
+	}
+}
+
+func TestFollowsFrom(t *testing.T) {
+	recs := append(testRecords(), rec("later", 9, sectiontrace.Begin, 200, args("f", int32(2))))
+	tr := Build(recs)
+
+	n := tr.Lookup("s", 9)
+	if n.Parent != nil || n.FollowsFrom == nil || n.FollowsFrom.Name != "a" {
+		t.Fatalf("follows-from not linked: %+v", n)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	links := []sectiontrace.Link{
+		{Section: sectiontrace.NodeAndScope{Scope: "s", ID: 2}},
+		{Section: sectiontrace.NodeAndScope{Scope: "elsewhere", ID: 2}},
+		{Section: sectiontrace.NodeAndScope{Scope: "s", ID: 3}},
+	}
+	tr := Build(append(testRecords(), rec("batch", 9, sectiontrace.Begin, 200, args("l", links))))
+
+	n := tr.Lookup("s", 9)
+	if len(n.Links) != 2 || n.Links[0].Name != "a" || n.Links[1].Name != "b" {
+		t.Fatalf("links not resolved: %+v", n.Links)
+	}
+}
+
+func TestCycle(t *testing.T) {
+	tr := Build([]*sectiontrace.Record{
+		rec("x", 1, sectiontrace.Begin, 0, args("p", int32(2))),
+		rec("y", 2, sectiontrace.Begin, 0, args("p", int32(1))),
+	})
+	if len(tr.Roots) == 0 {
+		t.Fatalf("cycle not broken")
+	}
+}
+
+func TestLanes(t *testing.T) {
+	tr := Build(testRecords())
+	lanes := tr.Lanes()
+
+	// a and b overlap, so b needs another lane, which it shares with the
+	// orphan. c is unclosed, so it can't nest inside the root.
+	want := map[int32]int{1: 0, 2: 0, 3: 1, 4: 1, 5: 1}
+	for id, lane := range want {
+		if got := lanes[tr.Lookup("s", id)]; got != lane {
+			t.Errorf("lane of %d = %d want %d", id, got, lane)
+		}
+	}
+}
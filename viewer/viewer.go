@@ -0,0 +1,40 @@
+package viewer
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed index.html
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+type pageData struct {
+	DataURL string
+}
+
+// Handler serves a self-contained trace viewer page. The page loads
+// sectiontrace Summary JSON from dataURL (which may be overridden with
+// the "src" query parameter), and can also open local files, so it
+// works without network access.
+func Handler(dataURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data := pageData{DataURL: dataURL}
+		if src := req.URL.Query().Get("src"); src != "" {
+			data.DataURL = src
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := indexTemplate.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
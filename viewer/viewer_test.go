@@ -0,0 +1,52 @@
+package viewer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler("/debug/trace.json").ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	w := get(t, http.MethodGet, "/debug/trace/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "<html") || !strings.Contains(body, "function buildModel") {
+		t.Errorf("page not served: %.200s", body)
+	}
+	if !strings.Contains(body, `const dataURL = "/debug/trace.json";`) {
+		t.Errorf("data URL not set")
+	}
+
+	if w := get(t, http.MethodHead, "/debug/trace/"); w.Code != http.StatusOK {
+		t.Errorf("HEAD status = %d", w.Code)
+	}
+	if w := get(t, http.MethodPost, "/debug/trace/"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d", w.Code)
+	}
+}
+
+func TestHandlerEscapesSrc(t *testing.T) {
+	src := `x";</script><script>alert(1)</script>`
+	body := get(t, http.MethodGet, "/debug/trace/?src="+url.QueryEscape(src)).Body.String()
+
+	if strings.Contains(body, "<script>alert(1)") || strings.Contains(body, `"x";`) {
+		t.Errorf("src not escaped")
+	}
+	if !strings.Contains(body, `const dataURL = "x\";\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e";`) {
+		t.Errorf("src not used as the data URL")
+	}
+}
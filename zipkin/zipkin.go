@@ -0,0 +1,114 @@
+package zipkin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/steinarvk/sectiontrace"
+	"github.com/steinarvk/sectiontrace/internal/export"
+	"github.com/steinarvk/sectiontrace/internal/spanid"
+	"github.com/steinarvk/sectiontrace/tree"
+)
+
+var DefaultEndpoint = "http://localhost:9411/api/v2/spans"
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+}
+
+// Span is a Zipkin v2 span.
+type Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint *Endpoint         `json:"localEndpoint,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// Convert turns a completed section into a Zipkin span. Sections that
+// were started from a RemoteInfo get the remote parent as their parent.
+func Convert(begin, end *sectiontrace.Record, serviceName string) *Span {
+	traceID := spanid.Trace(begin)
+	id := spanid.Span(begin.Scope, begin.ID)
+
+	s := &Span{
+		TraceID:       hex.EncodeToString(traceID[:]),
+		ID:            hex.EncodeToString(id[:]),
+		Name:          begin.Name,
+		Timestamp:     begin.TimestampMicros,
+		Duration:      end.TimestampMicros - begin.TimestampMicros,
+		LocalEndpoint: &Endpoint{ServiceName: serviceName},
+		Tags: map[string]string{
+			"sectiontrace.scope": begin.Scope,
+			"sectiontrace.id":    fmt.Sprint(begin.ID),
+		},
+	}
+	if parent, ok := spanid.Parent(begin); ok {
+		s.ParentID = hex.EncodeToString(parent[:])
+	}
+	if ok, _ := end.BoolArg(sectiontrace.ArgOK); !ok {
+		s.Tags["error"] = "true"
+	}
+	for k, v := range end.AllArgs() {
+		if !spanid.IsLinkArg(k) {
+			s.Tags[k] = fmt.Sprint(v)
+		}
+	}
+	// Zipkin has no span links, so list the linked spans in a tag.
+	var links []string
+	for _, link := range spanid.Links(begin) {
+		_, linkSpan := spanid.Link(link)
+		links = append(links, hex.EncodeToString(linkSpan[:]))
+	}
+	if len(links) > 0 {
+		s.Tags["sectiontrace.links"] = strings.Join(links, ",")
+	}
+	return s
+}
+
+// ConvertRecords pairs up records and converts the closed sections.
+func ConvertRecords(recs []*sectiontrace.Record, serviceName string) []*Span {
+	spans := []*Span{}
+	tree.Build(recs).Walk(func(n *tree.Node) bool {
+		if n.Closed() {
+			spans = append(spans, Convert(n.Begin, n.End, serviceName))
+		}
+		return true
+	})
+	return spans
+}
+
+// WriteJSON writes records as a JSON array of Zipkin v2 spans, as
+// accepted by Zipkin's POST /api/v2/spans.
+func WriteJSON(w io.Writer, recs []*sectiontrace.Record, serviceName string) error {
+	return json.NewEncoder(w).Encode(ConvertRecords(recs, serviceName))
+}
+
+// Exporter is a sectiontrace.Sink that sends completed sections to a
+// Zipkin collector in batches, retrying failed requests. Fields left as
+// zero get the defaults used by NewExporter, with DefaultEndpoint as the
+// endpoint.
+type Exporter = export.Exporter[*Span, format]
+
+func NewExporter(endpoint string) *Exporter {
+	return export.NewExporter[*Span, format](endpoint)
+}
+
+type format struct{}
+
+func (format) DefaultEndpoint() string { return DefaultEndpoint }
+func (format) ContentType() string     { return "application/json" }
+
+func (format) Convert(begin, end *sectiontrace.Record, serviceName string) *Span {
+	return Convert(begin, end, serviceName)
+}
+
+func (format) Encode(serviceName string, batch []*Span) ([]byte, error) {
+	return json.Marshal(batch)
+}
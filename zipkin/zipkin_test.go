@@ -0,0 +1,56 @@
+package zipkin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steinarvk/sectiontrace"
+)
+
+func TestExporter(t *testing.T) {
+	var mu sync.Mutex
+	var got []*Span
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var spans []*Span
+		if err := json.NewDecoder(req.Body).Decode(&spans); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		got = append(got, spans...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	e := NewExporter(server.URL)
+	e.ServiceName = "svc"
+	e.FlushInterval = time.Hour
+
+	client := &sectiontrace.Record{Name: "call", Scope: "client", ID: 7, TimestampMicros: 100, Args: map[string]interface{}{}}
+	clientEnd := &sectiontrace.Record{Name: "call", Scope: "client", ID: 7, TimestampMicros: 900, Args: map[string]interface{}{"ok": true}}
+	remoteArgs := map[string]interface{}{"rp": int32(7), "rps": "client", "ra": int32(7), "ras": "client"}
+	server1 := &sectiontrace.Record{Name: "serve", Scope: "server", ID: 1, TimestampMicros: 200, Args: remoteArgs}
+	server1End := &sectiontrace.Record{Name: "serve", Scope: "server", ID: 1, TimestampMicros: 300, Args: map[string]interface{}{"ok": false}}
+
+	e.OnEnd(client, clientEnd)
+	e.OnEnd(server1, server1End)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d spans", len(got))
+	}
+	if got[1].ParentID != got[0].ID || got[1].TraceID != got[0].TraceID {
+		t.Errorf("remote parent not linked: %+v %+v", got[0], got[1])
+	}
+	if got[1].Tags["error"] != "true" || got[1].Duration != 100 || got[1].LocalEndpoint.ServiceName != "svc" {
+		t.Errorf("unexpected span: %+v", got[1])
+	}
+}